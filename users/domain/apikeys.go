@@ -0,0 +1,62 @@
+package domain
+
+import (
+	"crypto/subtle"
+	"strings"
+)
+
+// ApiKey lets a user access their data from scripts. The key is made of the
+// id of the record and a secret, only the hash of the secret is stored.
+type ApiKey struct {
+	ID       string   `json:"id"`
+	UserID   string   `json:"userId"`
+	Name     string   `json:"name"`
+	Hash     string   `json:"hash"`
+	Scopes   []string `json:"scopes"`
+	Created  int64    `json:"created"`
+	Expires  int64    `json:"expires"`
+	LastUsed int64    `json:"lastUsed"`
+}
+
+// NewApiKey returns a record for the key with the given id and secret
+func NewApiKey(id, secret string) *ApiKey {
+	return &ApiKey{ID: id, Hash: hashToken(secret)}
+}
+
+// ApiKeyString joins the id and secret of a key into the key given to users
+func ApiKeyString(id, secret string) string {
+	return id + "." + secret
+}
+
+// ReadApiKey returns the record of a key after checking its secret
+func (domain *Domain) ReadApiKey(key string) (*ApiKey, error) {
+	parts := strings.SplitN(key, ".", 2)
+	if len(parts) != 2 {
+		return nil, ErrTokenInvalid
+	}
+	keys := []*ApiKey{}
+	if err := domain.apiKeys.Read(domain.idIndex.ToQuery(parts[0]), &keys); err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return nil, ErrTokenInvalid
+	}
+	if subtle.ConstantTimeCompare([]byte(keys[0].Hash), []byte(hashToken(parts[1]))) != 1 {
+		return nil, ErrTokenInvalid
+	}
+	return keys[0], nil
+}
+
+// ListApiKeys returns the keys of a user
+func (domain *Domain) ListApiKeys(userID string) ([]*ApiKey, error) {
+	keys := []*ApiKey{}
+	return keys, domain.apiKeys.Read(domain.userIDIndex.ToQuery(userID), &keys)
+}
+
+func (domain *Domain) SaveApiKey(key *ApiKey) error {
+	return domain.apiKeys.Create(key)
+}
+
+func (domain *Domain) DeleteApiKey(id string) error {
+	return domain.apiKeys.Delete(domain.idIndex.ToQuery(id))
+}
@@ -0,0 +1,43 @@
+package domain
+
+// Attempts tracks failed password attempts against an account or from a
+// client address
+type Attempts struct {
+	// ID is the user id or client address prefixed by user: or ip:
+	ID          string `json:"id"`
+	Failures    int    `json:"failures"`
+	LastFailure int64  `json:"lastFailure"`
+	LockedUntil int64  `json:"lockedUntil"`
+}
+
+// AccountKey is the attempts key of a user
+func AccountKey(userID string) string {
+	return "user:" + userID
+}
+
+// AddressKey is the attempts key of a client address
+func AddressKey(ip string) string {
+	return "ip:" + ip
+}
+
+// ReadAttempts returns the failed attempts of a key, a new record is
+// returned if there weren't any
+func (domain *Domain) ReadAttempts(key string) (*Attempts, error) {
+	as := []*Attempts{}
+	if err := domain.attempts.Read(domain.idIndex.ToQuery(key), &as); err != nil {
+		return nil, err
+	}
+	if len(as) == 0 {
+		return &Attempts{ID: key}, nil
+	}
+	return as[0], nil
+}
+
+func (domain *Domain) SaveAttempts(a *Attempts) error {
+	return domain.attempts.Create(a)
+}
+
+// DeleteAttempts clears the failed attempts and any lockout of a key
+func (domain *Domain) DeleteAttempts(key string) error {
+	return domain.attempts.Delete(domain.idIndex.ToQuery(key))
+}
@@ -0,0 +1,112 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	AuditLogin           = "login"
+	AuditLogout          = "logout"
+	AuditPasswordChange  = "password_change"
+	AuditPasswordReset   = "password_reset"
+	AuditSessionsRevoked = "sessions_revoked"
+	AuditImpersonate     = "impersonate"
+
+	AuditSuccess = "success"
+	AuditFailure = "failure"
+	// AuditChallenge is the outcome of a login that needs a two factor code
+	AuditChallenge = "challenge"
+)
+
+// AuditEvent records an authentication event. Events are never changed
+// once recorded, they're only deleted once the retention period is over.
+type AuditEvent struct {
+	ID     string `json:"id"`
+	UserID string `json:"userId"`
+	Type   string `json:"type"`
+	// Method is how the user authenticated, eg. password or oauth:github
+	Method    string `json:"method"`
+	Outcome   string `json:"outcome"`
+	Detail    string `json:"detail"`
+	IP        string `json:"ip"`
+	UserAgent string `json:"userAgent"`
+	Created   int64  `json:"created"`
+	// ActorID is the admin who acted for the user, eg. by impersonating them
+	ActorID string `json:"actorId"`
+}
+
+// RecordAuditEvent appends an event to the audit log
+func (domain *Domain) RecordAuditEvent(ev *AuditEvent) error {
+	ev.ID = uuid.New().String()
+	if ev.Created == 0 {
+		ev.Created = time.Now().Unix()
+	}
+	return domain.audit.Create(ev)
+}
+
+// ListAuditEvents returns a page of events, newest first, optionally of a
+// single user and between two unix times. Zero times are unbounded.
+func (domain *Domain) ListAuditEvents(userID string, from, to, limit, offset int64) ([]*AuditEvent, error) {
+	query := domain.auditIndex.ToQuery(nil)
+	if len(userID) > 0 {
+		query = domain.userAuditIndex.ToQuery(userID)
+	}
+	query.Limit = scanPageSize
+
+	events := []*AuditEvent{}
+	var skipped int64
+	for {
+		page := []*AuditEvent{}
+		if err := domain.audit.Read(query, &page); err != nil {
+			return nil, err
+		}
+		for _, ev := range page {
+			if to > 0 && ev.Created > to {
+				continue
+			}
+			if from > 0 && ev.Created < from {
+				return events, nil
+			}
+			if skipped < offset {
+				skipped++
+				continue
+			}
+			events = append(events, ev)
+			if int64(len(events)) == limit {
+				return events, nil
+			}
+		}
+		if len(page) < int(query.Limit) {
+			return events, nil
+		}
+		query.Offset += query.Limit
+	}
+}
+
+// DeleteAuditEvents deletes the events recorded before the given time and
+// returns how many were deleted
+func (domain *Domain) DeleteAuditEvents(before time.Time) (int, error) {
+	deleted := 0
+	for {
+		query := domain.createdIndex.ToQuery(nil)
+		query.Limit = 100
+		events := []*AuditEvent{}
+		if err := domain.audit.Read(query, &events); err != nil {
+			return deleted, err
+		}
+		for _, ev := range events {
+			if ev.Created >= before.Unix() {
+				return deleted, nil
+			}
+			if err := domain.audit.Delete(domain.idIndex.ToQuery(ev.ID)); err != nil {
+				return deleted, err
+			}
+			deleted++
+		}
+		if len(events) < int(query.Limit) {
+			return deleted, nil
+		}
+	}
+}
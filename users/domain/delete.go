@@ -0,0 +1,167 @@
+package domain
+
+import (
+	"errors"
+	"time"
+
+	user "github.com/embedscript/backend/users/proto"
+)
+
+var (
+	ErrUserDeleted    = errors.New("user has been deleted")
+	ErrUserNotDeleted = errors.New("user has not been deleted")
+)
+
+// deletion records when a user was soft deleted so they can be purged once
+// the retention period is over
+type deletion struct {
+	// ID of the user
+	ID      string `json:"id"`
+	Deleted int64  `json:"deleted"`
+}
+
+// Delete permanently deletes a user and everything they own. Users who are
+// the only owner of an org can't be deleted until the org has another owner
+// or is deleted, ErrLastOwner is returned.
+func (domain *Domain) Delete(id string) error {
+	if err := domain.checkOwnerships(id); err != nil {
+		return err
+	}
+	if err := domain.DeleteSessions(id); err != nil {
+		return err
+	}
+	if err := domain.deleteTokens(id); err != nil {
+		return err
+	}
+	keys, err := domain.ListApiKeys(id)
+	if err != nil {
+		return err
+	}
+	for _, k := range keys {
+		if err := domain.DeleteApiKey(k.ID); err != nil {
+			return err
+		}
+	}
+	ids := []*Identity{}
+	if err := domain.identities.Read(domain.userIDIndex.ToQuery(id), &ids); err != nil {
+		return err
+	}
+	for _, v := range ids {
+		if err := domain.identities.Delete(domain.idIndex.ToQuery(v.ID)); err != nil {
+			return err
+		}
+	}
+	if err := domain.DeleteTwoFactor(id); err != nil {
+		return err
+	}
+	if err := domain.DeleteAttempts(AccountKey(id)); err != nil {
+		return err
+	}
+	if err := domain.DeleteGrants(id); err != nil {
+		return err
+	}
+	if err := domain.deleteMemberships(id); err != nil {
+		return err
+	}
+	if err := domain.passwords.Delete(domain.idIndex.ToQuery(id)); err != nil {
+		return err
+	}
+	if err := domain.deletions.Delete(domain.idIndex.ToQuery(id)); err != nil {
+		return err
+	}
+	// the user goes last so a failed delete can be retried
+	return domain.users.Delete(domain.idIndex.ToQuery(id))
+}
+
+// SoftDelete marks a user as deleted and logs them out. Their data is kept
+// until it's purged so they can be restored, which also means their
+// username and email stay taken. Like Delete it returns ErrLastOwner for the
+// only owner of an org.
+func (domain *Domain) SoftDelete(id string) error {
+	usr, err := domain.Read(id)
+	if err != nil {
+		return err
+	}
+	if usr.Deleted > 0 {
+		return nil
+	}
+	if err := domain.checkOwnerships(id); err != nil {
+		return err
+	}
+	usr.Deleted = time.Now().Unix()
+	if err := domain.deletions.Create(deletion{ID: id, Deleted: usr.Deleted}); err != nil {
+		return err
+	}
+	if err := domain.Update(usr); err != nil {
+		return err
+	}
+	if err := domain.DeleteSessions(id); err != nil {
+		return err
+	}
+	return domain.deleteTokens(id)
+}
+
+// Restore undoes a soft delete
+func (domain *Domain) Restore(id string) (*user.User, error) {
+	usr, err := domain.Read(id)
+	if err != nil {
+		return nil, err
+	}
+	if usr.Deleted == 0 {
+		return nil, ErrUserNotDeleted
+	}
+	usr.Deleted = 0
+	if err := domain.Update(usr); err != nil {
+		return nil, err
+	}
+	return usr, domain.deletions.Delete(domain.idIndex.ToQuery(id))
+}
+
+// PurgeDeleted permanently deletes users soft deleted before the given time
+// and returns their ids. Users who became the only owner of an org while
+// deleted are kept until the org has another owner.
+func (domain *Domain) PurgeDeleted(before time.Time) ([]string, error) {
+	purged := []string{}
+	// users that were kept, they're still at the start of the index
+	var kept int64
+	for {
+		query := domain.deletedIndex.ToQuery(nil)
+		query.Limit = 100
+		query.Offset = kept
+		deletions := []*deletion{}
+		if err := domain.deletions.Read(query, &deletions); err != nil {
+			return purged, err
+		}
+		for _, del := range deletions {
+			if del.Deleted >= before.Unix() {
+				return purged, nil
+			}
+			err := domain.Delete(del.ID)
+			if err == ErrLastOwner {
+				kept++
+				continue
+			}
+			if err != nil {
+				return purged, err
+			}
+			purged = append(purged, del.ID)
+		}
+		if len(deletions) < int(query.Limit) {
+			return purged, nil
+		}
+	}
+}
+
+// deleteTokens deletes every outstanding token of a user
+func (domain *Domain) deleteTokens(userID string) error {
+	tokens := []*token{}
+	if err := domain.tokens.Read(domain.userIDIndex.ToQuery(userID), &tokens); err != nil {
+		return err
+	}
+	for _, t := range tokens {
+		if err := domain.tokens.Delete(domain.idIndex.ToQuery(t.ID)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
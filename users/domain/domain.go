@@ -1,7 +1,10 @@
 package domain
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
+	"strings"
 	"time"
 
 	user "github.com/embedscript/backend/users/proto"
@@ -12,19 +15,90 @@ type pw struct {
 	ID       string `json:"id"`
 	Password string `json:"password"`
 	Salt     string `json:"salt"`
+	// Version of the pepper the password was hashed with
+	Version int `json:"version"`
 }
 
+// token is a one-time token sent out by email, or a refresh token whose
+// data is the session it refreshes. Only the hash of the token is stored so
+// a leaked store doesn't leak usable tokens.
+type token struct {
+	ID       string `json:"id"`
+	UserID   string `json:"userId"`
+	Kind     string `json:"kind"`
+	Expires  int64  `json:"expires"`
+	Attempts int    `json:"attempts"`
+	// Data the token carries, eg. the new address of an email change
+	Data string `json:"data"`
+}
+
+const (
+	// TokenVerification is the kind of token used to verify email addresses
+	TokenVerification = "verification"
+	// TokenPasswordReset is the kind of token used to reset a forgotten password
+	TokenPasswordReset = "password-reset"
+	// TokenTwoFactorChallenge is the kind of token returned by the first step
+	// of a two factor login
+	TokenTwoFactorChallenge = "2fa-challenge"
+	// TokenEmailChange is the kind of token used to confirm a new email address
+	TokenEmailChange = "email-change"
+	// TokenLoginLink is the kind of token emailed to log in without a password
+	TokenLoginLink = "login-link"
+	// TokenOrgInvite is the kind of token emailed to invite someone to an org
+	TokenOrgInvite = "org-invite"
+	// TokenRefresh is the kind of token returned with access tokens to
+	// refresh the session they were issued for
+	TokenRefresh = "refresh"
+)
+
+var (
+	ErrTokenInvalid   = errors.New("token is invalid")
+	ErrTokenExpired   = errors.New("token has expired")
+	ErrSessionExpired = errors.New("session has expired")
+)
+
+// Domain holds the user pool of a single tenant
 type Domain struct {
-	users     model.Model
-	sessions  model.Model
-	passwords model.Model
+	tenant string
+
+	users       model.Model
+	sessions    model.Model
+	passwords   model.Model
+	tokens      model.Model
+	twoFactor   model.Model
+	identities  model.Model
+	oauthStates model.Model
+	attempts    model.Model
+	roles       model.Model
+	grants      model.Model
+	migrations  model.Model
+	deletions   model.Model
+	apiKeys     model.Model
+	audit       model.Model
+	invites     model.Model
+	orgs        model.Model
+	memberships model.Model
 
-	nameIndex  model.Index
-	emailIndex model.Index
-	idIndex    model.Index
+	nameIndex    model.Index
+	emailIndex   model.Index
+	idIndex      model.Index
+	userIDIndex  model.Index
+	expiresIndex model.Index
+	listIndex    model.Index
+	createdIndex model.Index
+	updatedIndex model.Index
+	deletedIndex model.Index
+	// audit events and invites are listed newest first
+	auditIndex     model.Index
+	userAuditIndex model.Index
+	orgNameIndex   model.Index
+	orgIDIndex     model.Index
 }
 
-func New() *Domain {
+// New returns the domain of a tenant. Each tenant's models are kept in their
+// own table so usernames and emails are only unique within a tenant. The
+// default tenant is blank and uses the service's own table.
+func New(tenant string) *Domain {
 	nameIndex := model.ByEquality("username")
 	nameIndex.Unique = true
 	nameIndex.Order.Type = model.OrderTypeUnordered
@@ -38,19 +112,110 @@ func New() *Domain {
 	idIndex := model.ByEquality("id")
 	idIndex.Order.Type = model.OrderTypeUnordered
 
+	// sessions, tokens and api keys are looked up by user to revoke them in bulk
+	userIDIndex := model.ByEquality("userId")
+	userIDIndex.Order.Type = model.OrderTypeUnordered
+
+	// expired sessions are swept oldest first
+	expiresIndex := model.ByEquality("expires")
+	expiresIndex.Order.Type = model.OrderTypeAsc
+
+	// users are listed by when they were created or last updated
+	createdIndex := model.ByEquality("created")
+	createdIndex.Order.Type = model.OrderTypeAsc
+
+	updatedIndex := model.ByEquality("updated")
+	updatedIndex.Order.Type = model.OrderTypeAsc
+
+	// soft deleted users are purged oldest first
+	deletedIndex := model.ByEquality("deleted")
+	deletedIndex.Order.Type = model.OrderTypeAsc
+
+	// audit events are listed newest first, optionally of a single user,
+	// and purged oldest first by the created index. Invites are listed
+	// newest first too.
+	auditIndex := model.ByEquality("created")
+	auditIndex.Order.Type = model.OrderTypeDesc
+
+	userAuditIndex := model.ByEquality("userId")
+	userAuditIndex.Order.FieldName = "created"
+	userAuditIndex.Order.Type = model.OrderTypeDesc
+
+	// org names are unique like usernames
+	orgNameIndex := model.ByEquality("name")
+	orgNameIndex.Unique = true
+	orgNameIndex.Order.Type = model.OrderTypeUnordered
+
+	// members of an org are listed by when they joined
+	orgIDIndex := model.ByEquality("orgId")
+	orgIDIndex.Order.FieldName = "created"
+	orgIDIndex.Order.Type = model.OrderTypeAsc
+
+	// roles are listed by name
+	listIndex := model.ByEquality("id")
+	listIndex.Order.Type = model.OrderTypeAsc
+
+	options := func(indexes ...model.Index) *model.Options {
+		opts := &model.Options{Indexes: indexes}
+		if len(tenant) > 0 {
+			opts.Table = "users-" + tenant
+		}
+		return opts
+	}
+
 	return &Domain{
-		users: model.New(user.User{}, &model.Options{
-			Indexes: []model.Index{nameIndex, emailIndex},
-		}),
-		sessions:   model.New(user.Session{}, nil),
-		passwords:  model.New(pw{}, nil),
-		nameIndex:  nameIndex,
-		emailIndex: emailIndex,
-		idIndex:    idIndex,
+		tenant:         tenant,
+		users:          model.New(user.User{}, options(nameIndex, emailIndex, createdIndex, updatedIndex)),
+		sessions:       model.New(user.Session{}, options(userIDIndex, expiresIndex)),
+		passwords:      model.New(pw{}, options()),
+		tokens:         model.New(token{}, options(userIDIndex, expiresIndex)),
+		twoFactor:      model.New(TwoFactor{}, options()),
+		identities:     model.New(Identity{}, options(userIDIndex)),
+		oauthStates:    model.New(OAuthState{}, options(expiresIndex)),
+		attempts:       model.New(Attempts{}, options()),
+		roles:          model.New(Role{}, options(listIndex)),
+		grants:         model.New(Grants{}, options()),
+		migrations:     model.New(migration{}, options()),
+		deletions:      model.New(deletion{}, options(deletedIndex)),
+		apiKeys:        model.New(ApiKey{}, options(userIDIndex)),
+		audit:          model.New(AuditEvent{}, options(auditIndex, userAuditIndex, createdIndex)),
+		invites:        model.New(Invite{}, options(auditIndex)),
+		orgs:           model.New(Org{}, options(orgNameIndex)),
+		memberships:    model.New(Membership{}, options(userIDIndex, orgIDIndex)),
+		nameIndex:      nameIndex,
+		emailIndex:     emailIndex,
+		idIndex:        idIndex,
+		userIDIndex:    userIDIndex,
+		expiresIndex:   expiresIndex,
+		listIndex:      listIndex,
+		createdIndex:   createdIndex,
+		updatedIndex:   updatedIndex,
+		deletedIndex:   deletedIndex,
+		auditIndex:     auditIndex,
+		userAuditIndex: userAuditIndex,
+		orgNameIndex:   orgNameIndex,
+		orgIDIndex:     orgIDIndex,
 	}
 }
 
+// migrate brings the tenant's data up to date
+func (domain *Domain) migrate() error {
+	if err := domain.Migrate("reindex-users-by-date", domain.reindexUsers); err != nil {
+		return err
+	}
+	if err := domain.Migrate("reindex-oauth-states-by-expiry", domain.reindexOAuthStates); err != nil {
+		return err
+	}
+	return domain.Migrate("reindex-tokens-by-expiry", domain.reindexTokens)
+}
+
+// Tenant returns the id of the tenant the domain belongs to
+func (domain *Domain) Tenant() string {
+	return domain.tenant
+}
+
 func (domain *Domain) CreateSession(sess *user.Session) error {
+	sess.Tenant = domain.tenant
 	if sess.Created == 0 {
 		sess.Created = time.Now().Unix()
 	}
@@ -59,37 +224,144 @@ func (domain *Domain) CreateSession(sess *user.Session) error {
 		sess.Expires = time.Now().Add(time.Hour * 24 * 7).Unix()
 	}
 
+	if sess.LastSeen == 0 {
+		sess.LastSeen = sess.Created
+	}
+
 	return domain.sessions.Create(sess)
 }
 
+// SessionHandle returns an id of a session that isn't a credential, unlike
+// the session id it can be shown to the user and logged
+func SessionHandle(id string) string {
+	return hashToken(id)[:32]
+}
+
+// DeleteSession deletes a session along with its refresh tokens
 func (domain *Domain) DeleteSession(id string) error {
+	sessions := []*user.Session{}
+	if err := domain.sessions.Read(domain.idIndex.ToQuery(id), &sessions); err != nil {
+		return err
+	}
+	for _, sess := range sessions {
+		if err := domain.deleteRefreshTokens(sess.UserId, sess.Id); err != nil {
+			return err
+		}
+	}
 	return domain.sessions.Delete(domain.idIndex.ToQuery(id))
 }
 
+// deleteRefreshTokens deletes the refresh tokens of a session of a user, or
+// of all their sessions if the session id is blank
+func (domain *Domain) deleteRefreshTokens(userID, sessionID string) error {
+	tokens := []*token{}
+	if err := domain.tokens.Read(domain.userIDIndex.ToQuery(userID), &tokens); err != nil {
+		return err
+	}
+	for _, t := range tokens {
+		if t.Kind != TokenRefresh || (len(sessionID) > 0 && t.Data != sessionID) {
+			continue
+		}
+		if err := domain.tokens.Delete(domain.idIndex.ToQuery(t.ID)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ListSessions returns the unexpired sessions of a user
+func (domain *Domain) ListSessions(userID string) ([]*user.Session, error) {
+	sessions := []*user.Session{}
+	if err := domain.sessions.Read(domain.userIDIndex.ToQuery(userID), &sessions); err != nil {
+		return nil, err
+	}
+	now := time.Now().Unix()
+	active := []*user.Session{}
+	for _, sess := range sessions {
+		if sess.Expires >= now {
+			active = append(active, sess)
+		}
+	}
+	return active, nil
+}
+
+// DeleteSessions deletes every session of a user and their refresh tokens
+func (domain *Domain) DeleteSessions(userID string) error {
+	sessions := []*user.Session{}
+	if err := domain.sessions.Read(domain.userIDIndex.ToQuery(userID), &sessions); err != nil {
+		return err
+	}
+	for _, sess := range sessions {
+		if err := domain.sessions.Delete(domain.idIndex.ToQuery(sess.Id)); err != nil {
+			return err
+		}
+	}
+	return domain.deleteRefreshTokens(userID, "")
+}
+
+// ReadSession reads a session, expired sessions are deleted and
+// ErrSessionExpired is returned
 func (domain *Domain) ReadSession(id string) (*user.Session, error) {
 	sess := &user.Session{}
 	// @todo there should be a Read in the model to get rid of this pattern
-	return sess, domain.sessions.Read(domain.idIndex.ToQuery(id), &sess)
+	if err := domain.sessions.Read(domain.idIndex.ToQuery(id), &sess); err != nil {
+		return nil, err
+	}
+	if sess.Expires < time.Now().Unix() {
+		if err := domain.DeleteSession(id); err != nil {
+			return nil, err
+		}
+		return nil, ErrSessionExpired
+	}
+	return sess, nil
+}
+
+// UpdateSession saves changes to an existing session
+func (domain *Domain) UpdateSession(sess *user.Session) error {
+	return domain.sessions.Create(sess)
 }
 
-func (domain *Domain) Create(user *user.User, salt string, password string) error {
-	user.Created = time.Now().Unix()
+// DeleteExpiredSessions deletes every session that expired before the given
+// time and returns how many were deleted
+func (domain *Domain) DeleteExpiredSessions(before time.Time) (int, error) {
+	deleted := 0
+	for {
+		query := domain.expiresIndex.ToQuery(nil)
+		query.Limit = 100
+		sessions := []*user.Session{}
+		if err := domain.sessions.Read(query, &sessions); err != nil {
+			return deleted, err
+		}
+		for _, sess := range sessions {
+			if sess.Expires >= before.Unix() {
+				return deleted, nil
+			}
+			if err := domain.DeleteSession(sess.Id); err != nil {
+				return deleted, err
+			}
+			deleted++
+		}
+		if len(sessions) < int(query.Limit) {
+			return deleted, nil
+		}
+	}
+}
+
+// Create saves a new user with their password. The created time of imported
+// users is kept.
+func (domain *Domain) Create(user *user.User, salt string, password string, version int) error {
+	if user.Created == 0 {
+		user.Created = time.Now().Unix()
+	}
 	user.Updated = time.Now().Unix()
 	err := domain.users.Create(user)
 	if err != nil {
 		return err
 	}
-	return domain.passwords.Create(pw{
-		ID:       user.Id,
-		Password: password,
-		Salt:     salt,
-	})
-}
-
-func (domain *Domain) Delete(id string) error {
-	return domain.users.Delete(domain.idIndex.ToQuery(id))
+	return domain.UpdatePassword(user.Id, salt, password, version)
 }
 
+// Update saves a user read with Read, every field is written back
 func (domain *Domain) Update(user *user.User) error {
 	user.Updated = time.Now().Unix()
 	return domain.users.Create(user)
@@ -100,51 +372,246 @@ func (domain *Domain) Read(id string) (*user.User, error) {
 	return user, domain.users.Read(domain.idIndex.ToQuery(id), user)
 }
 
+// Search returns the users with exactly the given username or email, use List
+// to search by prefix
 func (domain *Domain) Search(username, email string, limit, offset int64) ([]*user.User, error) {
 	var query model.Query
 	if len(username) > 0 {
-		query = domain.nameIndex.ToQuery(username)
+		query = domain.nameIndex.ToQuery(strings.ToLower(username))
 	} else if len(email) > 0 {
-		query = domain.emailIndex.ToQuery(email)
+		query = domain.emailIndex.ToQuery(strings.ToLower(email))
 	} else {
 		return nil, errors.New("username and email cannot be blank")
 	}
+	query.Limit = limit
+	query.Offset = offset
 
 	users := []*user.User{}
 	return users, domain.users.Read(query, &users)
 }
 
-func (domain *Domain) UpdatePassword(id string, salt string, password string) error {
+func (domain *Domain) UpdatePassword(id string, salt string, password string, version int) error {
 	return domain.passwords.Create(pw{
 		ID:       id,
 		Password: password,
 		Salt:     salt,
+		Version:  version,
 	})
 }
 
-func (domain *Domain) SaltAndPassword(username, email string) (string, string, error) {
+// Taken reports whether a username or email belongs to a user other than
+// the given one. Usernames are also taken by orgs.
+func (domain *Domain) Taken(username, email, userID string) (bool, error) {
+	if len(username) > 0 {
+		org, err := domain.ReadOrgByName(username)
+		if err != nil {
+			return false, err
+		}
+		if org != nil {
+			return true, nil
+		}
+	}
+	for _, v := range [][2]string{{username, ""}, {"", email}} {
+		if len(v[0]) == 0 && len(v[1]) == 0 {
+			continue
+		}
+		users, err := domain.Search(v[0], v[1], 0, 0)
+		if err != nil {
+			return false, err
+		}
+		for _, u := range users {
+			if u.Id != userID {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// Lookup reads a user by username, or by email if the username is blank
+func (domain *Domain) Lookup(username, email string) (*user.User, error) {
 	var query model.Query
 	if len(username) > 0 {
 		query = domain.nameIndex.ToQuery(username)
 	} else if len(email) > 0 {
 		query = domain.emailIndex.ToQuery(email)
 	} else {
-		return "", "", errors.New("username and email cannot be blank")
+		return nil, errors.New("username and email cannot be blank")
 	}
 
 	user := &user.User{}
-	err := domain.users.Read(query, &user)
+	return user, domain.users.Read(query, &user)
+}
+
+// Password returns the salt, hashed password and pepper version of a user
+func (domain *Domain) Password(id string) (string, string, int, error) {
+	query := model.QueryEquals("id", id)
+	query.Order.Type = model.OrderTypeUnordered
+
+	password := &pw{}
+	err := domain.passwords.Read(query, password)
+	if err != nil {
+		return "", "", 0, err
+	}
+	return password.Salt, password.Password, password.Version, nil
+}
+
+func hashToken(tok string) string {
+	h := sha256.Sum256([]byte(tok))
+	return hex.EncodeToString(h[:])
+}
+
+// CreateToken stores a one-time token of the given kind for a user
+func (domain *Domain) CreateToken(kind, tok, userID string, expires time.Time) error {
+	return domain.CreateTokenWithData(kind, tok, userID, "", expires)
+}
+
+// CreateTokenWithData stores a one-time token that carries data, which is
+// returned when it's redeemed
+func (domain *Domain) CreateTokenWithData(kind, tok, userID, data string, expires time.Time) error {
+	return domain.tokens.Create(token{
+		ID:      hashToken(tok),
+		UserID:  userID,
+		Kind:    kind,
+		Expires: expires.Unix(),
+		Data:    data,
+	})
+}
+
+func (domain *Domain) readToken(kind, tok string) (*token, error) {
+	t := &token{}
+	if err := domain.tokens.Read(domain.idIndex.ToQuery(hashToken(tok)), t); err != nil {
+		return nil, ErrTokenInvalid
+	}
+	if t.Kind != kind {
+		return nil, ErrTokenInvalid
+	}
+	return t, nil
+}
+
+// RedeemToken consumes a one-time token and returns the id of the user it
+// was issued for. The token is deleted whether or not it has expired.
+func (domain *Domain) RedeemToken(kind, tok string) (string, error) {
+	userID, _, err := domain.RedeemTokenWithData(kind, tok)
+	return userID, err
+}
+
+// RedeemTokenWithData consumes a one-time token and returns the id of the
+// user it was issued for and the data it carries
+func (domain *Domain) RedeemTokenWithData(kind, tok string) (string, string, error) {
+	t, err := domain.readToken(kind, tok)
 	if err != nil {
 		return "", "", err
 	}
+	if err := domain.tokens.Delete(domain.idIndex.ToQuery(t.ID)); err != nil {
+		return "", "", err
+	}
+	if t.Expires < time.Now().Unix() {
+		return "", "", ErrTokenExpired
+	}
+	return t.UserID, t.Data, nil
+}
 
-	query = model.QueryEquals("id", user.Id)
-	query.Order.Type = model.OrderTypeUnordered
+// ReadToken returns the id of the user a token was issued for without
+// consuming it, if it hasn't expired by now
+func (domain *Domain) ReadToken(kind, tok string, now time.Time) (string, error) {
+	userID, _, err := domain.ReadTokenWithData(kind, tok, now)
+	return userID, err
+}
 
-	password := &pw{}
-	err = domain.passwords.Read(query, password)
+// ReadTokenWithData is ReadToken that also returns the data the token carries
+func (domain *Domain) ReadTokenWithData(kind, tok string, now time.Time) (string, string, error) {
+	t, err := domain.readToken(kind, tok)
 	if err != nil {
 		return "", "", err
 	}
-	return password.Salt, password.Password, nil
+	if t.Expires < now.Unix() {
+		return "", "", ErrTokenExpired
+	}
+	return t.UserID, t.Data, nil
+}
+
+// DeleteExpiredTokens deletes every token that expired before the given
+// time, eg. links that were never followed or refresh tokens of sessions
+// that ended, and returns how many were deleted
+func (domain *Domain) DeleteExpiredTokens(before time.Time) (int, error) {
+	deleted := 0
+	for {
+		query := domain.expiresIndex.ToQuery(nil)
+		query.Limit = 100
+		tokens := []*token{}
+		if err := domain.tokens.Read(query, &tokens); err != nil {
+			return deleted, err
+		}
+		for _, t := range tokens {
+			if t.Expires >= before.Unix() {
+				return deleted, nil
+			}
+			if err := domain.tokens.Delete(domain.idIndex.ToQuery(t.ID)); err != nil {
+				return deleted, err
+			}
+			deleted++
+		}
+		if len(tokens) < int(query.Limit) {
+			return deleted, nil
+		}
+	}
+}
+
+// reindexTokens saves every token again so tokens created before the
+// expires index was added are swept
+func (domain *Domain) reindexTokens() error {
+	query := domain.idIndex.ToQuery(nil)
+	query.Limit = scanPageSize
+	for {
+		tokens := []*token{}
+		if err := domain.tokens.Read(query, &tokens); err != nil {
+			return err
+		}
+		for _, t := range tokens {
+			if err := domain.tokens.Create(t); err != nil {
+				return err
+			}
+		}
+		if len(tokens) < int(query.Limit) {
+			return nil
+		}
+		query.Offset += query.Limit
+	}
+}
+
+// DeleteToken deletes a token
+func (domain *Domain) DeleteToken(tok string) error {
+	return domain.tokens.Delete(domain.idIndex.ToQuery(hashToken(tok)))
+}
+
+// FailToken records a failed attempt at using a token, the token is deleted
+// once it reaches the maximum number of attempts
+func (domain *Domain) FailToken(kind, tok string, max int) error {
+	t, err := domain.readToken(kind, tok)
+	if err != nil {
+		return err
+	}
+	t.Attempts++
+	if t.Attempts >= max {
+		return domain.tokens.Delete(domain.idIndex.ToQuery(t.ID))
+	}
+	return domain.tokens.Create(t)
+}
+
+// DeleteTokens deletes all outstanding tokens of the given kind for a user
+func (domain *Domain) DeleteTokens(kind, userID string) error {
+	tokens := []*token{}
+	if err := domain.tokens.Read(domain.userIDIndex.ToQuery(userID), &tokens); err != nil {
+		return err
+	}
+	for _, t := range tokens {
+		if t.Kind != kind {
+			continue
+		}
+		if err := domain.tokens.Delete(domain.idIndex.ToQuery(t.ID)); err != nil {
+			return err
+		}
+	}
+	return nil
 }
@@ -0,0 +1,127 @@
+package domain
+
+import (
+	"time"
+)
+
+// Identity links an account at an external provider to a user
+type Identity struct {
+	// ID is the provider and the provider's subject, eg. github:1234
+	ID       string `json:"id"`
+	Provider string `json:"provider"`
+	Subject  string `json:"subject"`
+	UserID   string `json:"userId"`
+	Email    string `json:"email"`
+	Created  int64  `json:"created"`
+}
+
+// OAuthState is kept between sending a user to a provider and the provider
+// redirecting back. Like tokens only the hash of the state is stored.
+type OAuthState struct {
+	ID          string `json:"id"`
+	Provider    string `json:"provider"`
+	RedirectURL string `json:"redirectUrl"`
+	// Verifier is the PKCE code verifier
+	Verifier string `json:"verifier"`
+	Expires  int64  `json:"expires"`
+}
+
+func identityID(provider, subject string) string {
+	return provider + ":" + subject
+}
+
+// ReadIdentity returns the identity linked to an account at a provider, or
+// nil if it isn't linked to any user
+func (domain *Domain) ReadIdentity(provider, subject string) (*Identity, error) {
+	ids := []*Identity{}
+	if err := domain.identities.Read(domain.idIndex.ToQuery(identityID(provider, subject)), &ids); err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	return ids[0], nil
+}
+
+// LinkIdentity links an account at a provider to a user
+func (domain *Domain) LinkIdentity(provider, subject, userID, email string) error {
+	return domain.identities.Create(&Identity{
+		ID:       identityID(provider, subject),
+		Provider: provider,
+		Subject:  subject,
+		UserID:   userID,
+		Email:    email,
+		Created:  time.Now().Unix(),
+	})
+}
+
+// CreateOAuthState stores the state of an authorization request
+func (domain *Domain) CreateOAuthState(state string, s *OAuthState) error {
+	s.ID = hashToken(state)
+	return domain.oauthStates.Create(s)
+}
+
+// RedeemOAuthState consumes the state of an authorization request
+func (domain *Domain) RedeemOAuthState(state string) (*OAuthState, error) {
+	s := &OAuthState{}
+	query := domain.idIndex.ToQuery(hashToken(state))
+	if err := domain.oauthStates.Read(query, s); err != nil {
+		return nil, ErrTokenInvalid
+	}
+	if err := domain.oauthStates.Delete(query); err != nil {
+		return nil, err
+	}
+	if s.Expires < time.Now().Unix() {
+		return nil, ErrTokenExpired
+	}
+	return s, nil
+}
+
+// DeleteExpiredOAuthStates deletes the state of every authorization request
+// that expired before the given time, ie. the user never came back from the
+// provider, and returns how many were deleted
+func (domain *Domain) DeleteExpiredOAuthStates(before time.Time) (int, error) {
+	deleted := 0
+	for {
+		query := domain.expiresIndex.ToQuery(nil)
+		query.Limit = 100
+		states := []*OAuthState{}
+		if err := domain.oauthStates.Read(query, &states); err != nil {
+			return deleted, err
+		}
+		for _, s := range states {
+			if s.Expires >= before.Unix() {
+				return deleted, nil
+			}
+			if err := domain.oauthStates.Delete(domain.idIndex.ToQuery(s.ID)); err != nil {
+				return deleted, err
+			}
+			deleted++
+		}
+		if len(states) < int(query.Limit) {
+			return deleted, nil
+		}
+	}
+}
+
+// reindexOAuthStates saves every state again so states created before the
+// expires index was added are swept
+func (domain *Domain) reindexOAuthStates() error {
+	query := domain.idIndex.ToQuery(nil)
+	query.Limit = scanPageSize
+	for {
+		states := []*OAuthState{}
+		if err := domain.oauthStates.Read(query, &states); err != nil {
+			return err
+		}
+		for _, s := range states {
+			if err := domain.oauthStates.Create(s); err != nil {
+				return err
+			}
+		}
+		if len(states) < int(query.Limit) {
+			return nil
+		}
+		query.Offset += query.Limit
+	}
+}
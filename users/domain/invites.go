@@ -0,0 +1,100 @@
+package domain
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInviteInvalid = errors.New("invite code is invalid")
+	ErrInviteExpired = errors.New("invite code has expired")
+	ErrInviteUsedUp  = errors.New("invite code has been used up")
+	ErrInviteEmail   = errors.New("invite code is for another email address")
+)
+
+// Invite lets people sign up to a tenant that's invite only. The id is the
+// code handed out, invites bound to an email can only be used with it.
+type Invite struct {
+	ID    string `json:"id"`
+	Email string `json:"email"`
+	// MaxUses is how many users can sign up with the code, 0 for any number
+	MaxUses int64 `json:"maxUses"`
+	Uses    int64 `json:"uses"`
+	Created int64 `json:"created"`
+	Expires int64 `json:"expires"`
+}
+
+// ReadInvite returns the invite with the given code, or nil if there's none
+func (domain *Domain) ReadInvite(code string) (*Invite, error) {
+	invites := []*Invite{}
+	if err := domain.invites.Read(domain.idIndex.ToQuery(strings.ToUpper(code)), &invites); err != nil {
+		return nil, err
+	}
+	if len(invites) == 0 {
+		return nil, nil
+	}
+	return invites[0], nil
+}
+
+// CheckInvite returns the invite with the given code if it can be used to
+// sign up with the email
+func (domain *Domain) CheckInvite(code, email string, now time.Time) (*Invite, error) {
+	inv, err := domain.ReadInvite(code)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case inv == nil:
+		return nil, ErrInviteInvalid
+	case inv.Expires > 0 && inv.Expires <= now.Unix():
+		return nil, ErrInviteExpired
+	case inv.MaxUses > 0 && inv.Uses >= inv.MaxUses:
+		return nil, ErrInviteUsedUp
+	case len(inv.Email) > 0 && inv.Email != strings.ToLower(email):
+		return nil, ErrInviteEmail
+	}
+	return inv, nil
+}
+
+// ListInvites returns a page of invites, newest first
+func (domain *Domain) ListInvites(limit, offset int64) ([]*Invite, error) {
+	query := domain.auditIndex.ToQuery(nil)
+	query.Limit = limit
+	query.Offset = offset
+	invites := []*Invite{}
+	return invites, domain.invites.Read(query, &invites)
+}
+
+// UseInvite checks an invite again and counts a sign up against it. The use
+// is taken before the user is created, so sign ups racing for the last use
+// of an invite don't all get through.
+func (domain *Domain) UseInvite(code, email string, now time.Time) (*Invite, error) {
+	inv, err := domain.CheckInvite(code, email, now)
+	if err != nil {
+		return nil, err
+	}
+	inv.Uses++
+	return inv, domain.SaveInvite(inv)
+}
+
+// ReleaseInvite gives back the use of an invite taken by a sign up that
+// failed
+func (domain *Domain) ReleaseInvite(code string) error {
+	inv, err := domain.ReadInvite(code)
+	if err != nil || inv == nil {
+		return err
+	}
+	if inv.Uses > 0 {
+		inv.Uses--
+	}
+	return domain.SaveInvite(inv)
+}
+
+func (domain *Domain) SaveInvite(inv *Invite) error {
+	return domain.invites.Create(inv)
+}
+
+func (domain *Domain) DeleteInvite(code string) error {
+	return domain.invites.Delete(domain.idIndex.ToQuery(strings.ToUpper(code)))
+}
@@ -0,0 +1,54 @@
+package domain
+
+import (
+	"github.com/micro/micro/v3/service/model"
+)
+
+// SigningKey is a private key used to sign access tokens. Keys are shared by
+// every tenant, the tenant is one of the claims of a token.
+type SigningKey struct {
+	ID string `json:"id"`
+	// PrivateKey is PEM encoded
+	PrivateKey string `json:"privateKey"`
+	Created    int64  `json:"created"`
+	// Expires is when no token signed with the key can still be valid, the
+	// key is deleted after
+	Expires int64 `json:"expires"`
+}
+
+// Keys stores the signing keys
+type Keys struct {
+	keys         model.Model
+	createdIndex model.Index
+	idIndex      model.Index
+}
+
+func NewKeys() *Keys {
+	createdIndex := model.ByEquality("created")
+	createdIndex.Order.Type = model.OrderTypeAsc
+
+	idIndex := model.ByEquality("id")
+	idIndex.Order.Type = model.OrderTypeUnordered
+
+	return &Keys{
+		keys: model.New(SigningKey{}, &model.Options{
+			Indexes: []model.Index{createdIndex},
+		}),
+		createdIndex: createdIndex,
+		idIndex:      idIndex,
+	}
+}
+
+// List returns every signing key, oldest first
+func (k *Keys) List() ([]*SigningKey, error) {
+	keys := []*SigningKey{}
+	return keys, k.keys.Read(k.createdIndex.ToQuery(nil), &keys)
+}
+
+func (k *Keys) Save(key *SigningKey) error {
+	return k.keys.Create(key)
+}
+
+func (k *Keys) Delete(id string) error {
+	return k.keys.Delete(k.idIndex.ToQuery(id))
+}
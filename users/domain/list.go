@@ -0,0 +1,155 @@
+package domain
+
+import (
+	"errors"
+	"strings"
+
+	user "github.com/embedscript/backend/users/proto"
+	"github.com/micro/micro/v3/service/model"
+)
+
+const (
+	OrderByCreated = "created"
+	OrderByUpdated = "updated"
+
+	// users read from the store at a time while scanning
+	scanPageSize = 100
+)
+
+var ErrInvalidOrder = errors.New("users can only be ordered by created or updated")
+
+// ListOptions filters and pages through users
+type ListOptions struct {
+	// Query is matched case insensitively against the start of usernames
+	// and emails, a blank query matches every user
+	Query string
+	// OrderBy is created or updated, defaults to created
+	OrderBy    string
+	Descending bool
+	// Deleted lists soft deleted users instead of active ones
+	Deleted bool
+	Limit   int64
+	Offset  int64
+}
+
+// List returns a page of users matching the options and the total number of
+// matching users.
+//
+// @todo the model can't filter by prefix or count, so every user is scanned.
+// This is fine for admin screens but not for hot paths.
+func (domain *Domain) List(opts ListOptions) ([]*user.User, int64, error) {
+	var index model.Index
+	switch opts.OrderBy {
+	case "", OrderByCreated:
+		index = domain.createdIndex
+	case OrderByUpdated:
+		index = domain.updatedIndex
+	default:
+		return nil, 0, ErrInvalidOrder
+	}
+	query := strings.ToLower(opts.Query)
+	matches := func(u *user.User) bool {
+		if (u.Deleted > 0) != opts.Deleted {
+			return false
+		}
+		return strings.HasPrefix(u.Username, query) || strings.HasPrefix(u.Email, query)
+	}
+
+	// the index is ascending, a descending page is the mirror image of an
+	// ascending one so the total has to be known first
+	var total int64
+	if opts.Descending {
+		err := domain.scanUsers(index, func(u *user.User) bool {
+			if matches(u) {
+				total++
+			}
+			return true
+		})
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+	start, end := opts.Offset, opts.Offset+opts.Limit
+	if opts.Descending {
+		start, end = total-end, total-start
+	}
+
+	users := []*user.User{}
+	var i int64
+	err := domain.scanUsers(index, func(u *user.User) bool {
+		if !matches(u) {
+			return true
+		}
+		if i >= start && i < end {
+			users = append(users, u)
+		}
+		i++
+		// the total is already known so there's no need to read past the page
+		return !opts.Descending || i < end
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	if !opts.Descending {
+		total = i
+	}
+	if opts.Descending {
+		for l, r := 0, len(users)-1; l < r; l, r = l+1, r-1 {
+			users[l], users[r] = users[r], users[l]
+		}
+	}
+	return users, total, nil
+}
+
+// scanUsers calls fn with every user in the order of the index until it
+// returns false
+func (domain *Domain) scanUsers(index model.Index, fn func(*user.User) bool) error {
+	query := index.ToQuery(nil)
+	query.Limit = scanPageSize
+	for {
+		users := []*user.User{}
+		if err := domain.users.Read(query, &users); err != nil {
+			return err
+		}
+		for _, u := range users {
+			if !fn(u) {
+				return nil
+			}
+		}
+		if len(users) < int(query.Limit) {
+			return nil
+		}
+		query.Offset += query.Limit
+	}
+}
+
+// ScanUsers calls fn with every active user in the order they were created,
+// stopping at the first error fn returns
+func (domain *Domain) ScanUsers(fn func(*user.User) error) error {
+	var err error
+	scanErr := domain.scanUsers(domain.createdIndex, func(u *user.User) bool {
+		if u.Deleted > 0 {
+			return true
+		}
+		err = fn(u)
+		return err == nil
+	})
+	if scanErr != nil {
+		return scanErr
+	}
+	return err
+}
+
+// reindexUsers saves every user again so users created before the created
+// and updated indexes were added are listed
+func (domain *Domain) reindexUsers() error {
+	var err error
+	scanErr := domain.scanUsers(domain.nameIndex, func(u *user.User) bool {
+		err = domain.users.Create(u)
+		return err == nil
+	})
+	if scanErr != nil {
+		return scanErr
+	}
+	return err
+}
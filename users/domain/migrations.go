@@ -0,0 +1,24 @@
+package domain
+
+import "time"
+
+type migration struct {
+	ID      string `json:"id"`
+	Applied int64  `json:"applied"`
+}
+
+// Migrate runs a migration of the tenant's data once. Migrations have to be
+// safe to run again in case one fails part way or two instances race.
+func (domain *Domain) Migrate(name string, fn func() error) error {
+	ms := []*migration{}
+	if err := domain.migrations.Read(domain.idIndex.ToQuery(name), &ms); err != nil {
+		return err
+	}
+	if len(ms) > 0 {
+		return nil
+	}
+	if err := fn(); err != nil {
+		return err
+	}
+	return domain.migrations.Create(migration{ID: name, Applied: time.Now().Unix()})
+}
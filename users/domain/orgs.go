@@ -0,0 +1,189 @@
+package domain
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/micro/micro/v3/service/model"
+)
+
+// Roles members can have in an org, each can do everything the ones after it
+// can
+const (
+	OrgOwner  = "owner"
+	OrgAdmin  = "admin"
+	OrgMember = "member"
+)
+
+var (
+	ErrInvalidOrgRole = errors.New("role must be owner, admin or member")
+	ErrLastOwner      = errors.New("an org needs at least one owner")
+)
+
+var orgRoleRanks = map[string]int{OrgMember: 1, OrgAdmin: 2, OrgOwner: 3}
+
+// ValidOrgRole reports whether a role is one members can have
+func ValidOrgRole(role string) bool {
+	return orgRoleRanks[role] > 0
+}
+
+// OrgRoleAtLeast reports whether a role can do everything another one can
+func OrgRoleAtLeast(role, min string) bool {
+	return orgRoleRanks[role] >= orgRoleRanks[min]
+}
+
+// Org is a group of users that can own things, eg. websites and posts,
+// instead of a single user. Org names share the namespace of usernames.
+type Org struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+	Created     int64  `json:"created"`
+	Updated     int64  `json:"updated"`
+}
+
+// Membership is the role of a user in an org
+type Membership struct {
+	ID      string `json:"id"`
+	OrgID   string `json:"orgId"`
+	UserID  string `json:"userId"`
+	Role    string `json:"role"`
+	Created int64  `json:"created"`
+}
+
+func membershipID(orgID, userID string) string {
+	return orgID + ":" + userID
+}
+
+// NewMembership returns the membership of a user in an org
+func NewMembership(orgID, userID, role string) *Membership {
+	return &Membership{ID: membershipID(orgID, userID), OrgID: orgID, UserID: userID, Role: role}
+}
+
+// ReadOrg returns the org with the given id, or nil if there's none
+func (domain *Domain) ReadOrg(id string) (*Org, error) {
+	return domain.readOrg(domain.idIndex.ToQuery(id))
+}
+
+// ReadOrgByName returns the org with the given name, or nil if there's none
+func (domain *Domain) ReadOrgByName(name string) (*Org, error) {
+	return domain.readOrg(domain.orgNameIndex.ToQuery(strings.ToLower(name)))
+}
+
+func (domain *Domain) readOrg(query model.Query) (*Org, error) {
+	orgs := []*Org{}
+	if err := domain.orgs.Read(query, &orgs); err != nil {
+		return nil, err
+	}
+	if len(orgs) == 0 {
+		return nil, nil
+	}
+	return orgs[0], nil
+}
+
+func (domain *Domain) SaveOrg(org *Org) error {
+	return domain.orgs.Create(org)
+}
+
+// DeleteOrg deletes an org along with its memberships
+func (domain *Domain) DeleteOrg(id string) error {
+	members := []*Membership{}
+	if err := domain.memberships.Read(domain.orgIDIndex.ToQuery(id), &members); err != nil {
+		return err
+	}
+	for _, m := range members {
+		if err := domain.memberships.Delete(domain.idIndex.ToQuery(m.ID)); err != nil {
+			return err
+		}
+	}
+	// the org goes last so a failed delete can be retried
+	return domain.orgs.Delete(domain.idIndex.ToQuery(id))
+}
+
+// ReadMembership returns the membership of a user in an org, or nil if
+// they're not a member
+func (domain *Domain) ReadMembership(orgID, userID string) (*Membership, error) {
+	members := []*Membership{}
+	if err := domain.memberships.Read(domain.idIndex.ToQuery(membershipID(orgID, userID)), &members); err != nil {
+		return nil, err
+	}
+	if len(members) == 0 {
+		return nil, nil
+	}
+	return members[0], nil
+}
+
+// ListMembers returns a page of the members of an org, oldest first
+func (domain *Domain) ListMembers(orgID string, limit, offset int64) ([]*Membership, error) {
+	query := domain.orgIDIndex.ToQuery(orgID)
+	query.Limit = limit
+	query.Offset = offset
+	members := []*Membership{}
+	return members, domain.memberships.Read(query, &members)
+}
+
+// ListMemberships returns the memberships of a user
+func (domain *Domain) ListMemberships(userID string) ([]*Membership, error) {
+	members := []*Membership{}
+	return members, domain.memberships.Read(domain.userIDIndex.ToQuery(userID), &members)
+}
+
+func (domain *Domain) SaveMembership(m *Membership) error {
+	return domain.memberships.Create(m)
+}
+
+// DeleteMembership removes a user from an org
+func (domain *Domain) DeleteMembership(orgID, userID string) error {
+	return domain.memberships.Delete(domain.idIndex.ToQuery(membershipID(orgID, userID)))
+}
+
+// deleteMemberships removes a user from every org they're in
+func (domain *Domain) deleteMemberships(userID string) error {
+	members, err := domain.ListMemberships(userID)
+	if err != nil {
+		return err
+	}
+	for _, m := range members {
+		if err := domain.memberships.Delete(domain.idIndex.ToQuery(m.ID)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkOwnerships returns ErrLastOwner if the user is the only owner of an
+// org, removing them would leave it without one
+func (domain *Domain) checkOwnerships(userID string) error {
+	members, err := domain.ListMemberships(userID)
+	if err != nil {
+		return err
+	}
+	for _, m := range members {
+		if m.Role != OrgOwner {
+			continue
+		}
+		n, err := domain.CountOwners(m.OrgID)
+		if err != nil {
+			return err
+		}
+		if n <= 1 {
+			return ErrLastOwner
+		}
+	}
+	return nil
+}
+
+// CountOwners returns how many owners an org has
+func (domain *Domain) CountOwners(orgID string) (int, error) {
+	members := []*Membership{}
+	if err := domain.memberships.Read(domain.orgIDIndex.ToQuery(orgID), &members); err != nil {
+		return 0, err
+	}
+	var n int
+	for _, m := range members {
+		if m.Role == OrgOwner {
+			n++
+		}
+	}
+	return n, nil
+}
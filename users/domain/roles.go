@@ -0,0 +1,177 @@
+package domain
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+)
+
+var (
+	ErrInvalidRole = errors.New("role name may only contain letters, numbers, dots, dashes and underscores")
+
+	roleRegexp = regexp.MustCompile(`^[a-zA-Z0-9._-]{1,100}$`)
+)
+
+// Permission allows an action on a resource. Both may end in a * to match
+// anything with that prefix, a blank resource matches every resource.
+type Permission struct {
+	Name     string `json:"name"`
+	Resource string `json:"resource"`
+}
+
+// Allows reports whether the permission covers the action on the resource
+func (p Permission) Allows(name, resource string) bool {
+	if !match(p.Name, name) {
+		return false
+	}
+	return len(p.Resource) == 0 || match(p.Resource, resource)
+}
+
+func match(pattern, val string) bool {
+	if strings.HasSuffix(pattern, "*") {
+		return strings.HasPrefix(val, strings.TrimSuffix(pattern, "*"))
+	}
+	return pattern == val
+}
+
+// Role is a named set of permissions defined per tenant
+type Role struct {
+	// ID is the name of the role, eg. admin
+	ID          string       `json:"id"`
+	Permissions []Permission `json:"permissions"`
+	Created     int64        `json:"created"`
+	Updated     int64        `json:"updated"`
+}
+
+// Grants are the roles and permissions assigned to a user
+type Grants struct {
+	// ID of the user
+	ID          string       `json:"id"`
+	Roles       []string     `json:"roles"`
+	Permissions []Permission `json:"permissions"`
+}
+
+// AddRole assigns a role, returning false if it was already assigned
+func (g *Grants) AddRole(role string) bool {
+	for _, r := range g.Roles {
+		if r == role {
+			return false
+		}
+	}
+	g.Roles = append(g.Roles, role)
+	return true
+}
+
+// RemoveRole unassigns a role, returning false if it wasn't assigned
+func (g *Grants) RemoveRole(role string) bool {
+	for i, r := range g.Roles {
+		if r == role {
+			g.Roles = append(g.Roles[:i], g.Roles[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// AddPermission grants a permission, returning false if it was already granted
+func (g *Grants) AddPermission(p Permission) bool {
+	for _, v := range g.Permissions {
+		if v == p {
+			return false
+		}
+	}
+	g.Permissions = append(g.Permissions, p)
+	return true
+}
+
+// RemovePermission revokes a permission, returning false if it wasn't granted
+func (g *Grants) RemovePermission(p Permission) bool {
+	for i, v := range g.Permissions {
+		if v == p {
+			g.Permissions = append(g.Permissions[:i], g.Permissions[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// ValidRole reports whether a role name is valid
+func ValidRole(name string) bool {
+	return roleRegexp.MatchString(name)
+}
+
+// ReadRole returns a role, or nil if it doesn't exist
+func (domain *Domain) ReadRole(name string) (*Role, error) {
+	roles := []*Role{}
+	if err := domain.roles.Read(domain.idIndex.ToQuery(name), &roles); err != nil {
+		return nil, err
+	}
+	if len(roles) == 0 {
+		return nil, nil
+	}
+	return roles[0], nil
+}
+
+// ListRoles returns every role of the tenant ordered by name
+func (domain *Domain) ListRoles() ([]*Role, error) {
+	roles := []*Role{}
+	return roles, domain.roles.Read(domain.listIndex.ToQuery(nil), &roles)
+}
+
+func (domain *Domain) SaveRole(role *Role) error {
+	if !ValidRole(role.ID) {
+		return ErrInvalidRole
+	}
+	return domain.roles.Create(role)
+}
+
+func (domain *Domain) DeleteRole(name string) error {
+	return domain.roles.Delete(domain.idIndex.ToQuery(name))
+}
+
+// ReadGrants returns the roles and permissions of a user, empty grants are
+// returned if they have none
+func (domain *Domain) ReadGrants(userID string) (*Grants, error) {
+	grants := []*Grants{}
+	if err := domain.grants.Read(domain.idIndex.ToQuery(userID), &grants); err != nil {
+		return nil, err
+	}
+	if len(grants) == 0 {
+		return &Grants{ID: userID}, nil
+	}
+	return grants[0], nil
+}
+
+func (domain *Domain) SaveGrants(g *Grants) error {
+	return domain.grants.Create(g)
+}
+
+func (domain *Domain) DeleteGrants(userID string) error {
+	return domain.grants.Delete(domain.idIndex.ToQuery(userID))
+}
+
+// Authorize reports whether the grants allow an action on a resource, either
+// directly or through one of the roles. Roles that no longer exist are
+// ignored.
+func (domain *Domain) Authorize(g *Grants, name, resource string) (bool, error) {
+	for _, p := range g.Permissions {
+		if p.Allows(name, resource) {
+			return true, nil
+		}
+	}
+	for _, r := range g.Roles {
+		role, err := domain.ReadRole(r)
+		if err != nil {
+			return false, err
+		}
+		if role == nil {
+			continue
+		}
+		for _, p := range role.Permissions {
+			if p.Allows(name, resource) {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,108 @@
+package domain
+
+import (
+	"errors"
+	"regexp"
+	"sync"
+
+	"github.com/micro/micro/v3/service/model"
+)
+
+var (
+	ErrInvalidTenant = errors.New("tenant id may only contain letters, numbers, dots, dashes and underscores")
+	ErrUnknownTenant = errors.New("tenant does not exist")
+
+	tenantRegexp = regexp.MustCompile(`^[a-zA-Z0-9._-]{0,100}$`)
+)
+
+type tenant struct {
+	ID string `json:"id"`
+}
+
+// Tenants keeps the domain of every tenant. Tenants are created when the
+// first user signs up to them, and recorded so background jobs can run
+// across all of them.
+type Tenants struct {
+	sync.Mutex
+	domains   map[string]*Domain
+	tenants   model.Model
+	listIndex model.Index
+}
+
+func NewTenants() *Tenants {
+	listIndex := model.ByEquality("id")
+	listIndex.Order.Type = model.OrderTypeAsc
+
+	return &Tenants{
+		domains: map[string]*Domain{},
+		tenants: model.New(tenant{}, &model.Options{
+			Indexes: []model.Index{listIndex},
+		}),
+		listIndex: listIndex,
+	}
+}
+
+// Get returns the domain of an existing tenant, the blank tenant is the
+// default pool and always exists
+func (t *Tenants) Get(id string) (*Domain, error) {
+	return t.get(id, false)
+}
+
+// Create returns the domain of a tenant, creating the tenant if it doesn't
+// exist yet
+func (t *Tenants) Create(id string) (*Domain, error) {
+	return t.get(id, true)
+}
+
+func (t *Tenants) get(id string, create bool) (*Domain, error) {
+	if !tenantRegexp.MatchString(id) {
+		return nil, ErrInvalidTenant
+	}
+	t.Lock()
+	defer t.Unlock()
+	if d, ok := t.domains[id]; ok {
+		return d, nil
+	}
+	if len(id) > 0 {
+		tenants := []*tenant{}
+		if err := t.tenants.Read(t.listIndex.ToQuery(id), &tenants); err != nil {
+			return nil, err
+		}
+		if len(tenants) == 0 && !create {
+			return nil, ErrUnknownTenant
+		}
+		if len(tenants) == 0 {
+			if err := t.tenants.Create(tenant{ID: id}); err != nil {
+				return nil, err
+			}
+		}
+	}
+	d := New(id)
+	if err := d.migrate(); err != nil {
+		return nil, err
+	}
+	t.domains[id] = d
+	return d, nil
+}
+
+// List returns the domain of every tenant
+func (t *Tenants) List() ([]*Domain, error) {
+	tenants := []*tenant{}
+	if err := t.tenants.Read(t.listIndex.ToQuery(nil), &tenants); err != nil {
+		return nil, err
+	}
+	domains := []*Domain{}
+	seen := map[string]bool{}
+	for _, v := range append([]*tenant{{ID: ""}}, tenants...) {
+		if seen[v.ID] {
+			continue
+		}
+		seen[v.ID] = true
+		d, err := t.Get(v.ID)
+		if err != nil {
+			return nil, err
+		}
+		domains = append(domains, d)
+	}
+	return domains, nil
+}
@@ -0,0 +1,81 @@
+package domain
+
+import (
+	"crypto/subtle"
+	"strings"
+	"time"
+
+	"github.com/embedscript/backend/users/totp"
+)
+
+// TwoFactor is the two factor auth enrollment of a user
+type TwoFactor struct {
+	// ID of the user
+	ID     string `json:"id"`
+	Secret string `json:"secret"`
+	// Enabled once the user confirmed the secret with a code
+	Enabled bool `json:"enabled"`
+	// hashes of the unused recovery codes
+	RecoveryCodes []string `json:"recoveryCodes"`
+	// time step of the last accepted code, codes can't be used twice
+	LastCounter int64 `json:"lastCounter"`
+}
+
+// SetRecoveryCodes replaces the recovery codes, only their hashes are kept
+func (tf *TwoFactor) SetRecoveryCodes(codes []string) {
+	tf.RecoveryCodes = make([]string, len(codes))
+	for i, c := range codes {
+		tf.RecoveryCodes[i] = hashToken(c)
+	}
+}
+
+// UseRecoveryCode removes a recovery code, returning false if it's not valid
+func (tf *TwoFactor) UseRecoveryCode(code string) bool {
+	h := hashToken(code)
+	for i, c := range tf.RecoveryCodes {
+		if subtle.ConstantTimeCompare([]byte(c), []byte(h)) == 1 {
+			tf.RecoveryCodes = append(tf.RecoveryCodes[:i], tf.RecoveryCodes[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Verify checks a code from an authenticator app at time now, or a recovery
+// code. Either can only be used once, so a valid code is recorded and the
+// enrollment has to be saved afterwards.
+func (tf *TwoFactor) Verify(code string, now time.Time, skew int) bool {
+	code = strings.TrimSpace(code)
+	if len(code) == 0 {
+		return false
+	}
+	if counter, ok := totp.Validate(code, tf.Secret, now, skew); ok {
+		if counter <= tf.LastCounter {
+			return false
+		}
+		tf.LastCounter = counter
+		return true
+	}
+	return tf.UseRecoveryCode(strings.ToLower(code))
+}
+
+// ReadTwoFactor returns the two factor enrollment of a user, or nil if they
+// never enrolled
+func (domain *Domain) ReadTwoFactor(userID string) (*TwoFactor, error) {
+	tfs := []*TwoFactor{}
+	if err := domain.twoFactor.Read(domain.idIndex.ToQuery(userID), &tfs); err != nil {
+		return nil, err
+	}
+	if len(tfs) == 0 {
+		return nil, nil
+	}
+	return tfs[0], nil
+}
+
+func (domain *Domain) SaveTwoFactor(tf *TwoFactor) error {
+	return domain.twoFactor.Create(tf)
+}
+
+func (domain *Domain) DeleteTwoFactor(userID string) error {
+	return domain.twoFactor.Delete(domain.idIndex.ToQuery(userID))
+}
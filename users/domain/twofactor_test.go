@@ -0,0 +1,67 @@
+package domain
+
+import (
+	"testing"
+	"time"
+
+	"github.com/embedscript/backend/users/totp"
+)
+
+const testSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func testCode(t *testing.T, now time.Time) string {
+	t.Helper()
+	c, err := totp.Code(testSecret, totp.Counter(now))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestVerifyRejectsReplay(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	tf := &TwoFactor{Secret: testSecret, Enabled: true}
+	code := testCode(t, now)
+
+	if !tf.Verify(code, now, 1) {
+		t.Fatal("Verify() rejected a valid code")
+	}
+	if tf.Verify(code, now, 1) {
+		t.Error("Verify() accepted the same code twice")
+	}
+	// the code of the previous step is still within skew, but older than the
+	// one just used
+	if tf.Verify(testCode(t, now.Add(-totp.Period*time.Second)), now, 1) {
+		t.Error("Verify() accepted an older code")
+	}
+	if next := now.Add(totp.Period * time.Second); !tf.Verify(testCode(t, next), next, 1) {
+		t.Error("Verify() rejected the code of the next step")
+	}
+}
+
+func TestVerifyRecoveryCodes(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	tf := &TwoFactor{Secret: testSecret, Enabled: true}
+	tf.SetRecoveryCodes([]string{"aaaaa-bbbbb", "ccccc-ddddd"})
+
+	tests := []struct {
+		name string
+		code string
+		ok   bool
+		left int
+	}{
+		{name: "unknown", code: "eeeee-fffff", ok: false, left: 2},
+		{name: "valid", code: "aaaaa-bbbbb", ok: true, left: 1},
+		{name: "used", code: "aaaaa-bbbbb", ok: false, left: 1},
+		{name: "case and spaces", code: " CCCCC-DDDDD ", ok: true, left: 0},
+		{name: "empty", code: "", ok: false, left: 0},
+	}
+	for _, tt := range tests {
+		if ok := tf.Verify(tt.code, now, 1); ok != tt.ok {
+			t.Errorf("%v: Verify() = %v, want %v", tt.name, ok, tt.ok)
+		}
+		if len(tf.RecoveryCodes) != tt.left {
+			t.Errorf("%v: %v recovery codes left, want %v", tt.name, len(tf.RecoveryCodes), tt.left)
+		}
+	}
+}
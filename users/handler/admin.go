@@ -0,0 +1,67 @@
+package handler
+
+import (
+	"github.com/embedscript/backend/users/domain"
+	pb "github.com/embedscript/backend/users/proto"
+	"github.com/micro/micro/v3/service/auth"
+	"github.com/micro/micro/v3/service/errors"
+	"golang.org/x/net/context"
+)
+
+// trustedScopes are the scopes of micro accounts that can call admin RPCs
+// without a session: other services, and operators using the micro cli
+var trustedScopes = map[string]bool{"service": true, "admin": true}
+
+// trusted reports whether a request was made by a trusted micro account
+// rather than by a frontend on behalf of a user
+func trusted(ctx context.Context) bool {
+	acc, ok := auth.AccountFromContext(ctx)
+	if !ok {
+		return false
+	}
+	for _, scope := range acc.Scopes {
+		if trustedScopes[scope] {
+			return true
+		}
+	}
+	return false
+}
+
+// authorize checks the caller of an admin RPC. Trusted accounts can do
+// anything, anyone else needs a session whose user has the permission on
+// the resource.
+func (s *Users) authorize(ctx context.Context, d *domain.Domain, id, sessionID, permission, resource string) error {
+	if trusted(ctx) {
+		return nil
+	}
+	_, err := sessionAllowed(d, id, sessionID, permission, resource)
+	return err
+}
+
+// sessionAllowed reads a session and checks its user has the permission on
+// the resource. Impersonated sessions never do, so impersonating a user
+// can't be used to act with their permissions.
+func sessionAllowed(d *domain.Domain, id, sessionID, permission, resource string) (*pb.Session, error) {
+	if len(sessionID) == 0 {
+		return nil, errors.Unauthorized(id, "Missing session id")
+	}
+	sess, err := d.ReadSession(sessionID)
+	if err != nil {
+		return nil, errors.Unauthorized(id, "Invalid session")
+	}
+	if impersonated(sess) {
+		return nil, errors.Forbidden(id, "Impersonated sessions can't do this")
+	}
+	g, err := d.ReadGrants(sess.UserId)
+	if err != nil {
+		return nil, errors.InternalServerError(id, err.Error())
+	}
+	ok, err := d.Authorize(g, permission, resource)
+	if err != nil {
+		return nil, errors.InternalServerError(id, err.Error())
+	}
+	if !ok {
+		return nil, errors.Forbidden(id, "Not allowed to %v %v", permission, resource)
+	}
+	return sess, nil
+}
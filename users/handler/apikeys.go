@@ -0,0 +1,182 @@
+package handler
+
+import (
+	"time"
+
+	"github.com/embedscript/backend/users/domain"
+	pb "github.com/embedscript/backend/users/proto"
+	"github.com/micro/micro/v3/service/errors"
+	"github.com/micro/micro/v3/service/logger"
+	"golang.org/x/net/context"
+)
+
+// maxApiKeys is how many keys a user can have at once
+const maxApiKeys = 20
+
+func fromApiKey(k *domain.ApiKey) *pb.ApiKey {
+	return &pb.ApiKey{
+		Id:       k.ID,
+		UserId:   k.UserID,
+		Name:     k.Name,
+		Scopes:   k.Scopes,
+		Created:  k.Created,
+		Expires:  k.Expires,
+		LastUsed: k.LastUsed,
+	}
+}
+
+// apiKeyCaller checks api keys are managed with the user's own session.
+// Impersonated sessions can't, a key would outlive the impersonation.
+func apiKeyCaller(d *domain.Domain, id, sessionID, userID string) error {
+	caller, err := callerSession(d, id, sessionID, userID)
+	if err != nil {
+		return err
+	}
+	if impersonated(caller) {
+		return errors.Forbidden(id, "Impersonated sessions can't manage api keys")
+	}
+	return nil
+}
+
+func (s *Users) CreateApiKey(ctx context.Context, req *pb.CreateApiKeyRequest, rsp *pb.CreateApiKeyResponse) error {
+	d, err := s.domain(req.Tenant)
+	if err != nil {
+		return err
+	}
+	if err := apiKeyCaller(d, "users.CreateApiKey", req.SessionId, req.UserId); err != nil {
+		return err
+	}
+	usr, err := d.Read(req.UserId)
+	if err != nil || usr.Deleted > 0 {
+		return errors.NotFound("users.CreateApiKey", "User not found")
+	}
+	if req.Expires != 0 && req.Expires <= s.now().Unix() {
+		return errors.BadRequest("users.CreateApiKey", "Expiry is in the past")
+	}
+	for _, scope := range req.Scopes {
+		if len(scope) == 0 {
+			return errors.BadRequest("users.CreateApiKey", "Scopes can't be blank")
+		}
+	}
+	keys, err := d.ListApiKeys(usr.Id)
+	if err != nil {
+		return errors.InternalServerError("users.CreateApiKey", err.Error())
+	}
+	if len(keys) >= maxApiKeys {
+		return errors.BadRequest("users.CreateApiKey", "Users can have at most %v api keys", maxApiKeys)
+	}
+
+	id, secret := random(16), random(32)
+	key := domain.NewApiKey(id, secret)
+	key.UserID = usr.Id
+	key.Name = req.Name
+	key.Scopes = req.Scopes
+	key.Created = s.now().Unix()
+	key.Expires = req.Expires
+	if err := d.SaveApiKey(key); err != nil {
+		return errors.InternalServerError("users.CreateApiKey", err.Error())
+	}
+	rsp.ApiKey = fromApiKey(key)
+	rsp.Key = domain.ApiKeyString(id, secret)
+	return nil
+}
+
+func (s *Users) ListApiKeys(ctx context.Context, req *pb.ListApiKeysRequest, rsp *pb.ListApiKeysResponse) error {
+	d, err := s.domain(req.Tenant)
+	if err != nil {
+		return err
+	}
+	if len(req.UserId) == 0 {
+		return errors.BadRequest("users.ListApiKeys", "Missing user id")
+	}
+	if err := apiKeyCaller(d, "users.ListApiKeys", req.SessionId, req.UserId); err != nil {
+		return err
+	}
+	keys, err := d.ListApiKeys(req.UserId)
+	if err != nil {
+		return errors.InternalServerError("users.ListApiKeys", err.Error())
+	}
+	for _, k := range keys {
+		rsp.ApiKeys = append(rsp.ApiKeys, fromApiKey(k))
+	}
+	return nil
+}
+
+func (s *Users) RevokeApiKey(ctx context.Context, req *pb.RevokeApiKeyRequest, rsp *pb.RevokeApiKeyResponse) error {
+	d, err := s.domain(req.Tenant)
+	if err != nil {
+		return err
+	}
+	if err := apiKeyCaller(d, "users.RevokeApiKey", req.SessionId, req.UserId); err != nil {
+		return err
+	}
+	// only keys of the user whose session it is can be revoked
+	keys, err := d.ListApiKeys(req.UserId)
+	if err != nil {
+		return errors.InternalServerError("users.RevokeApiKey", err.Error())
+	}
+	for _, k := range keys {
+		if k.ID != req.Id {
+			continue
+		}
+		if err := d.DeleteApiKey(k.ID); err != nil {
+			return errors.InternalServerError("users.RevokeApiKey", err.Error())
+		}
+		return nil
+	}
+	return errors.NotFound("users.RevokeApiKey", "Api key not found")
+}
+
+// ValidateApiKey resolves a key to a session of the user it belongs to. The
+// session isn't stored and has no id, it's only valid as long as the key.
+func (s *Users) ValidateApiKey(ctx context.Context, req *pb.ValidateApiKeyRequest, rsp *pb.ValidateApiKeyResponse) error {
+	d, err := s.domain(req.Tenant)
+	if err != nil {
+		return err
+	}
+	if len(req.Key) == 0 {
+		return errors.Unauthorized("users.ValidateApiKey", "Missing api key")
+	}
+	key, err := d.ReadApiKey(req.Key)
+	if err == domain.ErrTokenInvalid {
+		return errors.Unauthorized("users.ValidateApiKey", "Invalid api key")
+	}
+	if err != nil {
+		return errors.InternalServerError("users.ValidateApiKey", err.Error())
+	}
+	now := s.now()
+	if key.Expires != 0 && key.Expires < now.Unix() {
+		return errors.Unauthorized("users.ValidateApiKey", "Api key has expired")
+	}
+	usr, err := d.Read(key.UserID)
+	if err != nil || usr.Deleted > 0 {
+		return errors.Unauthorized("users.ValidateApiKey", "Invalid api key")
+	}
+	g, err := d.ReadGrants(usr.Id)
+	if err != nil {
+		return errors.InternalServerError("users.ValidateApiKey", err.Error())
+	}
+
+	if now.Sub(time.Unix(key.LastUsed, 0)) > lastSeenInterval {
+		key.LastUsed = now.Unix()
+		if err := d.SaveApiKey(key); err != nil {
+			logger.Errorf("Error updating last use of api key %v: %v", key.ID, err)
+		}
+	}
+
+	ip, ua := clientInfo(ctx)
+	rsp.Session = &pb.Session{
+		Username:  usr.Username,
+		Email:     usr.Email,
+		Created:   key.Created,
+		Expires:   key.Expires,
+		UserId:    usr.Id,
+		Ip:        ip,
+		UserAgent: ua,
+		LastSeen:  key.LastUsed,
+		Tenant:    d.Tenant(),
+		Roles:     g.Roles,
+	}
+	rsp.ApiKey = fromApiKey(key)
+	return nil
+}
@@ -0,0 +1,122 @@
+package handler
+
+import (
+	"time"
+
+	"github.com/embedscript/backend/users/domain"
+	pb "github.com/embedscript/backend/users/proto"
+	"github.com/micro/micro/v3/service/errors"
+	"github.com/micro/micro/v3/service/logger"
+	"golang.org/x/net/context"
+)
+
+const (
+	methodPassword  = "password"
+	methodCode      = "2fa"
+	methodLoginLink = "login_link"
+	// password resets are recorded as using the emailed token
+	methodResetToken = "reset_token"
+	// oauth logins are recorded as oauth:<provider>
+	methodOAuth = "oauth"
+
+	defaultAuditRetention = 90 * 24 * time.Hour
+
+	// permissionAudit is needed on user/<id> to list the events of a user,
+	// or on user/* to list everyone's
+	permissionAudit = "users.audit"
+)
+
+type auditConf struct {
+	// how long audit events are kept, eg. "2160h"
+	Retention string `json:"retention"`
+}
+
+// newAuditEvent starts an event for the client making the request
+func newAuditEvent(ctx context.Context, typ, method string) *domain.AuditEvent {
+	ip, ua := clientInfo(ctx)
+	return &domain.AuditEvent{
+		Type:      typ,
+		Method:    method,
+		IP:        ip,
+		UserAgent: ua,
+	}
+}
+
+// audit records the outcome of an event, failing to record it doesn't fail
+// the request
+func (s *Users) audit(d *domain.Domain, ev *domain.AuditEvent, err error) {
+	if len(ev.Outcome) == 0 {
+		ev.Outcome = domain.AuditSuccess
+	}
+	if err != nil {
+		ev.Outcome = domain.AuditFailure
+		ev.Detail = errors.FromError(err).Detail
+	}
+	ev.Created = s.now().Unix()
+	if err := d.RecordAuditEvent(ev); err != nil {
+		logger.Errorf("Error recording %v audit event of user %v: %v", ev.Type, ev.UserID, err)
+	}
+}
+
+// auditLogin records the outcome of a login, the user is taken from the
+// session if it wasn't known before
+func (s *Users) auditLogin(d *domain.Domain, ev *domain.AuditEvent, sess *pb.Session, challenge string, err error) {
+	if sess != nil {
+		ev.UserID = sess.UserId
+	}
+	if err == nil && len(challenge) > 0 {
+		ev.Outcome = domain.AuditChallenge
+	}
+	s.audit(d, ev, err)
+	if ev.Outcome == domain.AuditSuccess {
+		publishLoggedIn(d, ev)
+	}
+}
+
+func (s *Users) ListAuditEvents(ctx context.Context, req *pb.ListAuditEventsRequest, rsp *pb.ListAuditEventsResponse) error {
+	d, err := s.domain(req.Tenant)
+	if err != nil {
+		return err
+	}
+	resource := "user/*"
+	if len(req.UserId) > 0 {
+		resource = "user/" + req.UserId
+	}
+	if err := s.authorize(ctx, d, "users.ListAuditEvents", req.SessionId, permissionAudit, resource); err != nil {
+		return err
+	}
+	if req.From > 0 && req.To > 0 && req.From > req.To {
+		return errors.BadRequest("users.ListAuditEvents", "From is after to")
+	}
+	limit, offset := pageOf(req.Limit, req.Offset)
+	events, err := d.ListAuditEvents(req.UserId, req.From, req.To, limit, offset)
+	if err != nil {
+		return errors.InternalServerError("users.ListAuditEvents", err.Error())
+	}
+	for _, ev := range events {
+		rsp.Events = append(rsp.Events, &pb.AuditEvent{
+			Id:        ev.ID,
+			UserId:    ev.UserID,
+			Type:      ev.Type,
+			Method:    ev.Method,
+			Outcome:   ev.Outcome,
+			Detail:    ev.Detail,
+			Ip:        ev.IP,
+			UserAgent: ev.UserAgent,
+			Created:   ev.Created,
+			ActorId:   ev.ActorID,
+		})
+	}
+	return nil
+}
+
+// purgeAuditEvents deletes audit events past the retention period
+func (s *Users) purgeAuditEvents(d *domain.Domain) {
+	n, err := d.DeleteAuditEvents(time.Now().Add(-s.auditRetention))
+	if err != nil {
+		logger.Errorf("Error purging audit events of tenant %q: %v", d.Tenant(), err)
+	}
+	if n > 0 {
+		logger.Infof("Purged %v audit events of tenant %q", n, d.Tenant())
+	}
+}
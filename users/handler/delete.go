@@ -0,0 +1,108 @@
+package handler
+
+import (
+	"time"
+
+	"github.com/embedscript/backend/users/domain"
+	pb "github.com/embedscript/backend/users/proto"
+	"github.com/micro/micro/v3/service/errors"
+	"github.com/micro/micro/v3/service/logger"
+	"golang.org/x/net/context"
+)
+
+const (
+	defaultDeleteRetention = 30 * 24 * time.Hour
+
+	// permissionDelete is needed on user/<id> to delete or restore another
+	// user, or to delete a user permanently
+	permissionDelete = "users.delete"
+)
+
+type deleteConf struct {
+	// keep deleted users until the retention period is over so they can
+	// be restored
+	Soft bool `json:"soft"`
+	// how long soft deleted users are kept, eg. "720h"
+	Retention string `json:"retention"`
+}
+
+func (s *Users) Delete(ctx context.Context, req *pb.DeleteRequest, rsp *pb.DeleteResponse) error {
+	d, err := s.domain(req.Tenant)
+	if err != nil {
+		return err
+	}
+	if len(req.Id) == 0 {
+		return errors.BadRequest("users.Delete", "Missing user id")
+	}
+	if err := s.deleteCaller(ctx, d, req.SessionId, req.Id, req.Permanent); err != nil {
+		return err
+	}
+	if _, err := d.Read(req.Id); err != nil {
+		return errors.NotFound("users.Delete", "User not found")
+	}
+	soft := s.config.Delete.Soft && !req.Permanent
+	if soft {
+		err = d.SoftDelete(req.Id)
+	} else {
+		err = d.Delete(req.Id)
+	}
+	if err == domain.ErrLastOwner {
+		return errors.BadRequest("users.Delete", "User is the only owner of an org, make someone else an owner or delete the org first")
+	}
+	if err != nil {
+		return errors.InternalServerError("users.Delete", err.Error())
+	}
+	publishDeleted(d, req.Id, soft)
+	return nil
+}
+
+// deleteCaller checks who deletes a user. Users can delete their own account
+// with their own session, anything else is an admin action. Permanent deletes
+// skip the retention period and can't be undone, so they always are.
+func (s *Users) deleteCaller(ctx context.Context, d *domain.Domain, sessionID, userID string, permanent bool) error {
+	if !permanent && !trusted(ctx) && len(sessionID) > 0 {
+		sess, err := d.ReadSession(sessionID)
+		if err == nil && sess.UserId == userID && !impersonated(sess) {
+			return nil
+		}
+	}
+	return s.authorize(ctx, d, "users.Delete", sessionID, permissionDelete, "user/"+userID)
+}
+
+// Restore undoes a soft delete. The user was logged out when they were
+// deleted, so only an admin can restore them.
+func (s *Users) Restore(ctx context.Context, req *pb.RestoreRequest, rsp *pb.RestoreResponse) error {
+	d, err := s.domain(req.Tenant)
+	if err != nil {
+		return err
+	}
+	if err := s.authorize(ctx, d, "users.Restore", req.SessionId, permissionDelete, "user/"+req.Id); err != nil {
+		return err
+	}
+	if _, err := d.Read(req.Id); err != nil {
+		return errors.NotFound("users.Restore", "User not found")
+	}
+	usr, err := d.Restore(req.Id)
+	if err == domain.ErrUserNotDeleted {
+		return errors.BadRequest("users.Restore", err.Error())
+	}
+	if err != nil {
+		return errors.InternalServerError("users.Restore", err.Error())
+	}
+	rsp.User = usr
+	return nil
+}
+
+// purgeDeleted permanently deletes users whose retention period is over
+func (s *Users) purgeDeleted(d *domain.Domain) {
+	ids, err := d.PurgeDeleted(time.Now().Add(-s.deleteRetention))
+	for _, id := range ids {
+		publishDeleted(d, id, false)
+	}
+	if err != nil {
+		logger.Errorf("Error purging deleted users of tenant %q: %v", d.Tenant(), err)
+	}
+	if len(ids) > 0 {
+		logger.Infof("Purged %v deleted users of tenant %q", len(ids), d.Tenant())
+	}
+}
@@ -0,0 +1,94 @@
+package handler
+
+import (
+	"time"
+
+	"github.com/embedscript/backend/users/domain"
+	pb "github.com/embedscript/backend/users/proto"
+	"github.com/golang/protobuf/proto"
+	"github.com/micro/micro/v3/service/errors"
+	"github.com/micro/micro/v3/service/logger"
+	"golang.org/x/net/context"
+)
+
+const emailChangeExpiry = 24 * time.Hour
+
+// requestEmailChange emails a token to confirm the new address to it, and
+// lets the current address know a change was requested
+func (s *Users) requestEmailChange(ctx context.Context, d *domain.Domain, usr *pb.User) error {
+	// only the latest requested address can be confirmed
+	if err := d.DeleteTokens(domain.TokenEmailChange, usr.Id); err != nil {
+		return err
+	}
+	tok := random(32)
+	if err := d.CreateTokenWithData(domain.TokenEmailChange, tok, usr.Id, usr.PendingEmail, time.Now().Add(emailChangeExpiry)); err != nil {
+		return err
+	}
+	if err := s.sendEmail(ctx, usr.PendingEmail, s.config.Sendgrid.EmailChangeTemplateID, map[string]interface{}{
+		"username": usr.Username,
+		"token":    tok,
+		"email":    usr.PendingEmail,
+		"tenant":   d.Tenant(),
+	}); err != nil {
+		return err
+	}
+	if len(usr.Email) == 0 {
+		return nil
+	}
+	// the change can still be cancelled, so failing to warn the current
+	// address shouldn't stop it
+	if err := s.sendEmail(ctx, usr.Email, s.config.Sendgrid.EmailChangedTemplateID, map[string]interface{}{
+		"username": usr.Username,
+		"email":    usr.PendingEmail,
+		"tenant":   d.Tenant(),
+	}); err != nil {
+		logger.Errorf("Error notifying user %v of email change: %v", usr.Id, err)
+	}
+	return nil
+}
+
+func (s *Users) ConfirmEmail(ctx context.Context, req *pb.ConfirmEmailRequest, rsp *pb.ConfirmEmailResponse) error {
+	d, err := s.domain(req.Tenant)
+	if err != nil {
+		return err
+	}
+	if len(req.Token) == 0 {
+		return errors.BadRequest("users.ConfirmEmail", "Missing token")
+	}
+	userID, email, err := d.RedeemTokenWithData(domain.TokenEmailChange, req.Token)
+	if err != nil {
+		return errors.BadRequest("users.ConfirmEmail", err.Error())
+	}
+	usr, err := d.Read(userID)
+	if err != nil {
+		return errors.InternalServerError("users.ConfirmEmail", err.Error())
+	}
+	if usr.PendingEmail != email {
+		return errors.BadRequest("users.ConfirmEmail", "Email change has been cancelled or replaced")
+	}
+	taken, err := d.Taken("", email, usr.Id)
+	if err != nil {
+		return errors.InternalServerError("users.ConfirmEmail", err.Error())
+	}
+	if taken {
+		return errors.Conflict("users.ConfirmEmail", "Email is already in use")
+	}
+
+	before := proto.Clone(usr).(*pb.User)
+	usr.Email = email
+	usr.PendingEmail = ""
+	// following the link proves they own the address
+	usr.Verified = true
+	if err := d.Update(usr); err != nil {
+		return errors.InternalServerError("users.ConfirmEmail", err.Error())
+	}
+	publishUpdated(d, before, usr)
+	if !before.Verified {
+		publishVerified(d, usr)
+	}
+	if err := d.DeleteTokens(domain.TokenVerification, usr.Id); err != nil {
+		logger.Errorf("Error deleting verification tokens of user %v: %v", usr.Id, err)
+	}
+	rsp.User = usr
+	return nil
+}
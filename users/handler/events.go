@@ -0,0 +1,79 @@
+package handler
+
+import (
+	"reflect"
+	"time"
+
+	"github.com/embedscript/backend/users/domain"
+	pb "github.com/embedscript/backend/users/proto"
+	"github.com/embedscript/backend/users/subscriber"
+	"github.com/micro/micro/v3/service/events"
+	"github.com/micro/micro/v3/service/logger"
+)
+
+// publish publishes an event. The change it's about has already been made,
+// so a failure is only logged.
+func publish(topic string, msg interface{}) {
+	if err := events.Publish(topic, msg); err != nil {
+		logger.Errorf("Error publishing %v event: %v", topic, err)
+	}
+}
+
+func publishCreated(d *domain.Domain, usr *pb.User) {
+	publish(subscriber.TopicCreated, &pb.UserCreated{User: usr, Tenant: d.Tenant()})
+}
+
+func publishVerified(d *domain.Domain, usr *pb.User) {
+	publish(subscriber.TopicVerified, &pb.UserVerified{User: usr, Tenant: d.Tenant()})
+}
+
+// publishUpdated publishes the user after an update along with the fields
+// that changed, nothing is published if none did
+func publishUpdated(d *domain.Domain, before, after *pb.User) {
+	fields := changedFields(before, after)
+	if len(fields) == 0 {
+		return
+	}
+	publish(subscriber.TopicUpdated, &pb.UserUpdated{User: after, Tenant: d.Tenant(), Fields: fields})
+}
+
+func publishDeleted(d *domain.Domain, id string, soft bool) {
+	publish(subscriber.TopicDeleted, &pb.UserDeleted{
+		Id:      id,
+		Tenant:  d.Tenant(),
+		Soft:    soft,
+		Deleted: time.Now().Unix(),
+	})
+}
+
+func publishLoggedIn(d *domain.Domain, ev *domain.AuditEvent) {
+	publish(subscriber.TopicLoggedIn, &pb.UserLoggedIn{
+		UserId:    ev.UserID,
+		Tenant:    d.Tenant(),
+		Method:    ev.Method,
+		Ip:        ev.IP,
+		UserAgent: ev.UserAgent,
+		Timestamp: ev.Created,
+	})
+}
+
+// changedFields returns the names of the profile fields that differ
+func changedFields(before, after *pb.User) []string {
+	var fields []string
+	for _, f := range []struct {
+		name    string
+		changed bool
+	}{
+		{fieldUsername, before.Username != after.Username},
+		{fieldEmail, before.Email != after.Email},
+		{"pendingEmail", before.PendingEmail != after.PendingEmail},
+		{fieldDisplayName, before.DisplayName != after.DisplayName},
+		{fieldAvatarURL, before.AvatarUrl != after.AvatarUrl},
+		{fieldMetadata, !reflect.DeepEqual(before.Metadata, after.Metadata) && len(before.Metadata)+len(after.Metadata) > 0},
+	} {
+		if f.changed {
+			fields = append(fields, f.name)
+		}
+	}
+	return fields
+}
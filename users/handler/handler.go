@@ -2,23 +2,29 @@ package handler
 
 import (
 	"crypto/rand"
-	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"regexp"
 	"strings"
 	"time"
 
+	eproto "github.com/embedscript/backend/emails/proto"
 	"github.com/embedscript/backend/users/domain"
+	"github.com/embedscript/backend/users/oauth"
 	pb "github.com/embedscript/backend/users/proto"
+	"github.com/golang/protobuf/proto"
+	"github.com/google/uuid"
+	"github.com/micro/micro/v3/service/config"
+	"github.com/micro/micro/v3/service/context/metadata"
 	"github.com/micro/micro/v3/service/errors"
-	"golang.org/x/crypto/bcrypt"
+	"github.com/micro/micro/v3/service/logger"
 	"golang.org/x/net/context"
 )
 
-const (
-	x = "cruft123"
-)
-
 var (
 	alphanum = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789"
+
+	nonAlphanum = regexp.MustCompile(`[^a-z0-9]+`)
 )
 
 func random(i int) string {
@@ -33,36 +39,400 @@ func random(i int) string {
 	return "ughwhy?!!!"
 }
 
+const (
+	verificationExpiry  = 24 * time.Hour
+	passwordResetExpiry = time.Hour
+
+	defaultSessionTTL         = 7 * 24 * time.Hour
+	defaultSessionMaxLifetime = 30 * 24 * time.Hour
+	sweepInterval             = time.Hour
+	// how often the last seen time of a session is written back
+	lastSeenInterval = 5 * time.Minute
+
+	defaultPageSize = 25
+	maxPageSize     = 100
+
+	// permissionList is needed on user/* to list or search users
+	permissionList = "users.list"
+)
+
+type sendgridConf struct {
+	VerificationTemplateID  string `json:"verification_template_id"`
+	PasswordResetTemplateID string `json:"password_reset_template_id"`
+	// sent to a new address to confirm it
+	EmailChangeTemplateID string `json:"email_change_template_id"`
+	// sent to the current address when a change is requested
+	EmailChangedTemplateID string `json:"email_changed_template_id"`
+	LoginLinkTemplateID    string `json:"login_link_template_id"`
+	OrgInviteTemplateID    string `json:"org_invite_template_id"`
+}
+
+type sessionConf struct {
+	// how long a session is valid for after login or refresh, eg. "168h"
+	TTL string `json:"ttl"`
+	// how long a session can be kept alive by refreshing it, eg. "720h"
+	MaxLifetime string `json:"max_lifetime"`
+}
+
+type conf struct {
+	// reject logins from users who haven't verified their email yet
+	RequireVerification bool              `json:"require_verification"`
+	Sendgrid            sendgridConf      `json:"sendgrid"`
+	Session             sessionConf       `json:"session"`
+	Password            passwordConf      `json:"password"`
+	TwoFactor           twoFactorConf     `json:"two_factor"`
+	Lockout             lockoutConf       `json:"lockout"`
+	Profile             profileConf       `json:"profile"`
+	Policy              policyConf        `json:"policy"`
+	Delete              deleteConf        `json:"delete"`
+	Audit               auditConf         `json:"audit"`
+	LoginLink           loginLinkConf     `json:"login_link"`
+	JWT                 jwtConf           `json:"jwt"`
+	Impersonation       impersonationConf `json:"impersonation"`
+	// require an invite code to sign up
+	InviteOnly bool `json:"invite_only"`
+	// oauth providers by name, eg. github or google
+	OAuth map[string]oauth.Config `json:"oauth"`
+	// settings that differ per tenant by tenant id
+	Tenants map[string]tenantConf `json:"tenants"`
+}
+
 type Users struct {
-	domain *domain.Domain
+	tenants      *domain.Tenants
+	emailService eproto.EmailsService
+	config       conf
+	hasher       *hasher
+	providers    *oauth.Providers
+	lockout      *lockout
+	profile      *profile
+	// username and password policies of tenants that set their own
+	policies      map[string]*policy
+	defaultPolicy *policy
+	signer        *signer
+
+	sessionTTL         time.Duration
+	sessionMaxLifetime time.Duration
+	deleteRetention    time.Duration
+	loginLinkExpiry    time.Duration
+	auditRetention     time.Duration
+	impersonationTTL   time.Duration
+
+	// now returns the current time, used to validate time based codes
+	now func() time.Time
+}
+
+// parseDuration parses a duration from config, falling back to the default
+// if it's unset or invalid
+func parseDuration(name, val string, def time.Duration) time.Duration {
+	if len(val) == 0 {
+		return def
+	}
+	d, err := time.ParseDuration(val)
+	if err != nil || d <= 0 {
+		logger.Warnf("Invalid %v %q, using default %v", name, val, def)
+		return def
+	}
+	return d
+}
+
+func NewUsers(emailService eproto.EmailsService) *Users {
+	c := conf{}
+	val, err := config.Get("micro.users")
+	if err != nil {
+		logger.Warnf("Error getting config: %v", err)
+	}
+	err = val.Scan(&c)
+	if err != nil {
+		logger.Warnf("Error scanning config: %v", err)
+	}
+
+	providers, err := oauth.New(c.OAuth)
+	if err != nil {
+		logger.Fatalf("Error configuring oauth providers: %v", err)
+	}
+
+	u := &Users{
+		tenants:            domain.NewTenants(),
+		emailService:       emailService,
+		config:             c,
+		hasher:             newHasher(c.Password),
+		providers:          providers,
+		lockout:            newLockout(c.Lockout),
+		profile:            newProfile(c.Profile),
+		policies:           newPolicies(c),
+		defaultPolicy:      newPolicy(c.Policy),
+		signer:             newSigner(c.JWT),
+		sessionTTL:         parseDuration("session.ttl", c.Session.TTL, defaultSessionTTL),
+		sessionMaxLifetime: parseDuration("session.max_lifetime", c.Session.MaxLifetime, defaultSessionMaxLifetime),
+		deleteRetention:    parseDuration("delete.retention", c.Delete.Retention, defaultDeleteRetention),
+		loginLinkExpiry:    parseDuration("login_link.expiry", c.LoginLink.Expiry, defaultLoginLinkExpiry),
+		auditRetention:     parseDuration("audit.retention", c.Audit.Retention, defaultAuditRetention),
+		impersonationTTL:   parseDuration("impersonation.ttl", c.Impersonation.TTL, defaultImpersonationTTL),
+		now:                time.Now,
+	}
+	go u.sweep()
+	return u
+}
+
+// sweep periodically purges expired sessions, tokens and oauth states, soft
+// deleted users and audit events past their retention period and expired
+// signing keys from the store
+func (s *Users) sweep() {
+	t := time.NewTicker(sweepInterval)
+	defer t.Stop()
+	for range t.C {
+		s.signer.rotate(time.Now())
+
+		domains, err := s.tenants.List()
+		if err != nil {
+			logger.Errorf("Error listing tenants: %v", err)
+			continue
+		}
+		for _, d := range domains {
+			n, err := d.DeleteExpiredSessions(time.Now())
+			if err != nil {
+				logger.Errorf("Error sweeping expired sessions of tenant %q: %v", d.Tenant(), err)
+				continue
+			}
+			if n > 0 {
+				logger.Infof("Swept %v expired sessions of tenant %q", n, d.Tenant())
+			}
+			s.purgeTokens(d)
+			s.purgeOAuthStates(d)
+			s.purgeDeleted(d)
+			s.purgeAuditEvents(d)
+		}
+	}
+}
+
+// purgeTokens deletes tokens that can't be used anymore
+func (s *Users) purgeTokens(d *domain.Domain) {
+	n, err := d.DeleteExpiredTokens(time.Now())
+	if err != nil {
+		logger.Errorf("Error purging tokens of tenant %q: %v", d.Tenant(), err)
+	}
+	if n > 0 {
+		logger.Infof("Purged %v expired tokens of tenant %q", n, d.Tenant())
+	}
+}
+
+// domain returns the user pool of an existing or configured tenant
+func (s *Users) domain(tenant string) (*domain.Domain, error) {
+	if _, ok := s.config.Tenants[tenant]; ok {
+		return s.createDomain(tenant)
+	}
+	d, err := s.tenants.Get(tenant)
+	if err == domain.ErrInvalidTenant {
+		return nil, errors.BadRequest("users.tenant", err.Error())
+	}
+	if err == domain.ErrUnknownTenant {
+		return nil, errors.NotFound("users.tenant", err.Error())
+	}
+	if err != nil {
+		return nil, errors.InternalServerError("users.tenant", err.Error())
+	}
+	return d, nil
+}
+
+// createDomain returns the user pool of a tenant, creating the tenant if
+// it's new. Only signing up and importing users create tenants, so requests
+// for made up tenants don't leave anything behind.
+func (s *Users) createDomain(tenant string) (*domain.Domain, error) {
+	d, err := s.tenants.Create(tenant)
+	if err == domain.ErrInvalidTenant {
+		return nil, errors.BadRequest("users.tenant", err.Error())
+	}
+	if err != nil {
+		return nil, errors.InternalServerError("users.tenant", err.Error())
+	}
+	return d, nil
 }
 
-func NewUsers() *Users {
-	return &Users{
-		domain: domain.New(),
+// clientInfo returns the address and user agent of the client making the
+// request, as passed on by the api gateway. The gateway appends the address
+// it was called from to X-Forwarded-For, so only the last entry is used, the
+// ones before it are sent by the client and can be anything.
+func clientInfo(ctx context.Context) (string, string) {
+	ip, _ := metadata.Get(ctx, "X-Forwarded-For")
+	if i := strings.LastIndex(ip, ","); i >= 0 {
+		ip = ip[i+1:]
+	}
+	if len(ip) == 0 {
+		ip, _ = metadata.Get(ctx, "Remote")
 	}
+	ua, _ := metadata.Get(ctx, "User-Agent")
+	return strings.TrimSpace(ip), ua
 }
 
 func (s *Users) Create(ctx context.Context, req *pb.CreateRequest, rsp *pb.CreateResponse) error {
-	if len(req.Password) < 8 {
-		return errors.InternalServerError("users.Create.Check", "Password is less than 8 characters")
+	d, err := s.createDomain(req.Tenant)
+	if err != nil {
+		return err
+	}
+	user := &pb.User{
+		Id:          req.Id,
+		Username:    strings.ToLower(req.Username),
+		Email:       strings.ToLower(req.Email),
+		DisplayName: req.DisplayName,
+		AvatarUrl:   req.AvatarUrl,
+		Metadata:    req.Metadata,
+	}
+	var errs fieldErrors
+	p := s.policy(req.Tenant)
+	p.username(&errs, user.Username)
+	p.password(&errs, fieldPassword, req.Password)
+	s.profile.validate(&errs, user)
+	var inv *domain.Invite
+	if s.inviteOnly(req.Tenant) {
+		if inv, err = s.checkInvite(&errs, d, req.InviteCode, user.Email); err != nil {
+			return errors.InternalServerError("users.Create", err.Error())
+		}
+	}
+	if err := errs.err("users.Create"); err != nil {
+		return err
 	}
-	salt := random(16)
-	h, err := bcrypt.GenerateFromPassword([]byte(x+salt+req.Password), 10)
+	salt, pp, version, err := s.hasher.hash(req.Password)
 	if err != nil {
 		return errors.InternalServerError("users.Create", err.Error())
 	}
-	pp := base64.StdEncoding.EncodeToString(h)
+	if _, err := d.Read(user.Id); err == nil {
+		return errors.Conflict("users.Create", "User already exists")
+	}
+	if err := checkTaken(d, "users.Create", user.Username, "", user.Id); err != nil {
+		return err
+	}
+	if err := checkTaken(d, "users.Create", "", user.Email, user.Id); err != nil {
+		return err
+	}
+	if inv != nil {
+		if err := s.useInvite(d, "users.Create", inv.ID, user.Email); err != nil {
+			return err
+		}
+	}
+	if err := d.Create(user, salt, pp, version); err != nil {
+		if inv != nil {
+			if err := d.ReleaseInvite(inv.ID); err != nil {
+				logger.Errorf("Error releasing use of invite %v: %v", inv.ID, err)
+			}
+		}
+		return err
+	}
+	publishCreated(d, user)
 
-	return s.domain.Create(&pb.User{
-		Id:       req.Id,
-		Username: strings.ToLower(req.Username),
-		Email:    strings.ToLower(req.Email),
-	}, salt, pp)
+	// the account exists at this point, a failed email can be retried
+	// with ResendVerification so we don't fail the request
+	if err := s.sendVerification(ctx, d, user); err != nil {
+		logger.Errorf("Error sending verification email to user %v: %v", user.Id, err)
+	}
+	return nil
+}
+
+// createPasswordless creates a user who signed in some other way than with a
+// password, eg. with a provider or a login link. They get a random password
+// they can't sign in with until they reset it.
+func (s *Users) createPasswordless(d *domain.Domain, username, email string, verified bool) (*pb.User, error) {
+	username, err := availableUsername(d, s.policy(d.Tenant()), username, email)
+	if err != nil {
+		return nil, err
+	}
+	salt, pp, version, err := s.hasher.hash(random(32))
+	if err != nil {
+		return nil, err
+	}
+	usr := &pb.User{
+		Id:       uuid.New().String(),
+		Username: username,
+		Email:    email,
+		Verified: verified,
+	}
+	if err := d.Create(usr, salt, pp, version); err != nil {
+		return nil, err
+	}
+	publishCreated(d, usr)
+	return usr, nil
+}
+
+// claimAccount marks the email of a user as verified once someone proved
+// they own it without knowing the password. Anyone could have signed up with
+// the address before, so the password is reset and the sessions, api keys,
+// two factor auth and email change left from then are removed, or whoever
+// signed up would keep access to the account.
+func (s *Users) claimAccount(d *domain.Domain, usr *pb.User) error {
+	if usr.Verified {
+		return nil
+	}
+	salt, pp, version, err := s.hasher.hash(random(32))
+	if err != nil {
+		return err
+	}
+	if err := d.UpdatePassword(usr.Id, salt, pp, version); err != nil {
+		return err
+	}
+	if err := d.DeleteSessions(usr.Id); err != nil {
+		return err
+	}
+	keys, err := d.ListApiKeys(usr.Id)
+	if err != nil {
+		return err
+	}
+	for _, k := range keys {
+		if err := d.DeleteApiKey(k.ID); err != nil {
+			return err
+		}
+	}
+	if err := d.DeleteTwoFactor(usr.Id); err != nil {
+		return err
+	}
+	if err := d.DeleteTokens(domain.TokenEmailChange, usr.Id); err != nil {
+		return err
+	}
+	usr.PendingEmail = ""
+	usr.Verified = true
+	if err := d.Update(usr); err != nil {
+		return err
+	}
+	publishVerified(d, usr)
+	return nil
+}
+
+// availableUsername picks an unused username based on the one given or the
+// email address, within the length limits of the policy. Reserved names are
+// treated as taken.
+func availableUsername(d *domain.Domain, p *policy, username, email string) (string, error) {
+	base := username
+	if len(base) == 0 {
+		base = strings.Split(email, "@")[0]
+	}
+	base = nonAlphanum.ReplaceAllString(strings.ToLower(base), "")
+	if len(base) == 0 {
+		base = "user"
+	}
+	// leave room for the random suffix
+	if n := p.usernameMax - 4; n > 0 && len(base) > n {
+		base = base[:n]
+	}
+	username = base
+	for i := 0; i < 10; i++ {
+		if len(username) >= p.usernameMin && !p.reserved[username] {
+			taken, err := d.Taken(username, "", "")
+			if err != nil {
+				return "", err
+			}
+			if !taken {
+				return username, nil
+			}
+		}
+		username = base + strings.ToLower(random(4))
+	}
+	return "", fmt.Errorf("failed to find an available username")
 }
 
 func (s *Users) Read(ctx context.Context, req *pb.ReadRequest, rsp *pb.ReadResponse) error {
-	user, err := s.domain.Read(req.Id)
+	d, err := s.domain(req.Tenant)
+	if err != nil {
+		return err
+	}
+	user, err := d.Read(req.Id)
 	if err != nil {
 		return err
 	}
@@ -71,104 +441,677 @@ func (s *Users) Read(ctx context.Context, req *pb.ReadRequest, rsp *pb.ReadRespo
 }
 
 func (s *Users) Update(ctx context.Context, req *pb.UpdateRequest, rsp *pb.UpdateResponse) error {
-	return s.domain.Update(&pb.User{
-		Id:       req.Id,
-		Username: strings.ToLower(req.Username),
-		Email:    strings.ToLower(req.Email),
-	})
+	d, err := s.domain(req.Tenant)
+	if err != nil {
+		return err
+	}
+	usr, err := d.Read(req.Id)
+	if err != nil {
+		return errors.NotFound("users.Update", "User not found")
+	}
+	caller, err := callerSession(d, "users.Update", req.SessionId, usr.Id)
+	if err != nil {
+		return err
+	}
+	before := proto.Clone(usr).(*pb.User)
+	username, email := usr.Username, usr.Email
+	if err := applyUpdate(usr, req); err != nil {
+		return errors.BadRequest("users.Update", err.Error())
+	}
+	var errs fieldErrors
+	// existing usernames are kept even if the policy has changed since
+	if usr.Username != username {
+		s.policy(req.Tenant).username(&errs, usr.Username)
+	}
+	if len(usr.Email) == 0 && len(email) > 0 {
+		errs.add(fieldEmail, codeRequired, "%v can't be blank", fieldEmail)
+	}
+	s.profile.validate(&errs, usr)
+	if err := errs.err("users.Update"); err != nil {
+		return err
+	}
+
+	// a new email only replaces the current one once it's confirmed
+	changeEmail := usr.Email != email
+	if changeEmail && impersonated(caller) {
+		return errors.Forbidden("users.Update", "Impersonated sessions can't change the email")
+	}
+	if changeEmail {
+		usr.PendingEmail = usr.Email
+		usr.Email = email
+	}
+	if usr.Username != username {
+		if err := checkTaken(d, "users.Update", usr.Username, "", usr.Id); err != nil {
+			return err
+		}
+	}
+	if changeEmail {
+		if err := checkTaken(d, "users.Update", "", usr.PendingEmail, usr.Id); err != nil {
+			return err
+		}
+	}
+
+	if err := d.Update(usr); err != nil {
+		return errors.InternalServerError("users.Update", err.Error())
+	}
+	publishUpdated(d, before, usr)
+	if changeEmail {
+		if err := s.requestEmailChange(ctx, d, usr); err != nil {
+			return errors.InternalServerError("users.Update", err.Error())
+		}
+	}
+	rsp.User = usr
+	return nil
 }
 
-func (s *Users) Delete(ctx context.Context, req *pb.DeleteRequest, rsp *pb.DeleteResponse) error {
-	return s.domain.Delete(req.Id)
+// checkTaken returns a conflict error if the username or email belongs to
+// another user
+func checkTaken(d *domain.Domain, id, username, email, userID string) error {
+	taken, err := d.Taken(username, email, userID)
+	if err != nil {
+		return errors.InternalServerError(id, err.Error())
+	}
+	if !taken {
+		return nil
+	}
+	if len(username) > 0 {
+		return errors.Conflict(id, "Username is already taken")
+	}
+	return errors.Conflict(id, "Email is already in use")
 }
 
+// Search finds users by exact username or email, which anyone can do, or
+// lists users matching a query for admin screens. Listing and looking up
+// deleted users need permissionList.
 func (s *Users) Search(ctx context.Context, req *pb.SearchRequest, rsp *pb.SearchResponse) error {
-	users, err := s.domain.Search(req.Username, req.Email, req.Limit, req.Offset)
+	d, err := s.domain(req.Tenant)
 	if err != nil {
 		return err
 	}
+	lookup := len(req.Username) > 0 || len(req.Email) > 0
+	if !lookup || req.Deleted {
+		if err := s.authorize(ctx, d, "users.Search", req.SessionId, permissionList, "user/*"); err != nil {
+			return err
+		}
+	}
+	limit, offset := pageOf(req.Limit, req.Offset)
+	if lookup {
+		users, err := d.Search(req.Username, req.Email, limit, offset)
+		if err != nil {
+			return err
+		}
+		for _, u := range users {
+			if (u.Deleted > 0) == req.Deleted {
+				rsp.Users = append(rsp.Users, u)
+			}
+		}
+		rsp.Total = int64(len(rsp.Users))
+		return nil
+	}
+	users, total, err := d.List(domain.ListOptions{
+		Query:      req.Query,
+		OrderBy:    req.OrderBy,
+		Descending: req.Descending,
+		Deleted:    req.Deleted,
+		Limit:      limit,
+		Offset:     offset,
+	})
+	if err == domain.ErrInvalidOrder {
+		return errors.BadRequest("users.Search", err.Error())
+	}
+	if err != nil {
+		return errors.InternalServerError("users.Search", err.Error())
+	}
 	rsp.Users = users
+	rsp.Total = total
 	return nil
 }
 
-func (s *Users) UpdatePassword(ctx context.Context, req *pb.UpdatePasswordRequest, rsp *pb.UpdatePasswordResponse) error {
-	usr, err := s.domain.Read(req.UserId)
+func (s *Users) List(ctx context.Context, req *pb.ListRequest, rsp *pb.ListResponse) error {
+	d, err := s.domain(req.Tenant)
 	if err != nil {
-		return errors.InternalServerError("users.updatepassword", err.Error())
+		return err
 	}
-	if req.NewPassword != req.ConfirmPassword {
-		return errors.InternalServerError("users.updatepassword", "Passwords don't math")
+	if err := s.authorize(ctx, d, "users.List", req.SessionId, permissionList, "user/*"); err != nil {
+		return err
 	}
+	limit, offset := pageOf(req.Limit, req.Offset)
+	users, total, err := d.List(domain.ListOptions{
+		OrderBy:    req.OrderBy,
+		Descending: req.Descending,
+		Deleted:    req.Deleted,
+		Limit:      limit,
+		Offset:     offset,
+	})
+	if err == domain.ErrInvalidOrder {
+		return errors.BadRequest("users.List", err.Error())
+	}
+	if err != nil {
+		return errors.InternalServerError("users.List", err.Error())
+	}
+	rsp.Users = users
+	rsp.Total = total
+	return nil
+}
+
+// pageOf clamps the limit and offset of a paginated request
+func pageOf(limit, offset int64) (int64, int64) {
+	if limit <= 0 {
+		limit = defaultPageSize
+	}
+	if limit > maxPageSize {
+		limit = maxPageSize
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	return limit, offset
+}
+
+func (s *Users) UpdatePassword(ctx context.Context, req *pb.UpdatePasswordRequest, rsp *pb.UpdatePasswordResponse) (err error) {
+	d, err := s.domain(req.Tenant)
+	if err != nil {
+		return err
+	}
+	ev := newAuditEvent(ctx, domain.AuditPasswordChange, methodPassword)
+	ev.UserID = req.UserId
+	defer func() { s.audit(d, ev, err) }()
 
-	salt, hashed, err := s.domain.SaltAndPassword(usr.Username, usr.Email)
+	usr, err := d.Read(req.UserId)
 	if err != nil {
 		return errors.InternalServerError("users.updatepassword", err.Error())
 	}
+	caller, err := callerSession(d, "users.updatepassword", req.SessionId, usr.Id)
+	if err != nil {
+		return err
+	}
+	if impersonated(caller) {
+		return errors.Forbidden("users.updatepassword", "Impersonated sessions can't change the password")
+	}
+	var errs fieldErrors
+	s.policy(req.Tenant).password(&errs, fieldNewPassword, req.NewPassword)
+	if req.NewPassword != req.ConfirmPassword {
+		errs.add(fieldConfirmPassword, codeMismatch, "Passwords don't match")
+	}
+	if err := errs.err("users.updatepassword"); err != nil {
+		return err
+	}
+
+	ip, _ := clientInfo(ctx)
+	keys := s.lockout.keys(usr.Id, ip)
+	if err := s.lockout.check(d, s.now(), "users.updatepassword", keys...); err != nil {
+		return err
+	}
 
-	hh, err := base64.StdEncoding.DecodeString(hashed)
+	salt, hashed, version, err := d.Password(usr.Id)
 	if err != nil {
 		return errors.InternalServerError("users.updatepassword", err.Error())
 	}
 
-	if err := bcrypt.CompareHashAndPassword(hh, []byte(x+salt+req.OldPassword)); err != nil {
+	if err := s.hasher.verify(req.OldPassword, salt, hashed, version); err != nil {
+		s.lockout.fail(d, s.now(), keys...)
 		return errors.Unauthorized("users.updatepassword", err.Error())
 	}
+	s.lockout.succeed(d, usr.Id)
 
-	salt = random(16)
-	h, err := bcrypt.GenerateFromPassword([]byte(x+salt+req.NewPassword), 10)
+	salt, pp, version, err := s.hasher.hash(req.NewPassword)
 	if err != nil {
 		return errors.InternalServerError("users.updatepassword", err.Error())
 	}
-	pp := base64.StdEncoding.EncodeToString(h)
 
-	if err := s.domain.UpdatePassword(req.UserId, salt, pp); err != nil {
+	if err := d.UpdatePassword(req.UserId, salt, pp, version); err != nil {
+		return errors.InternalServerError("users.updatepassword", err.Error())
+	}
+	if err := d.DeleteSessions(req.UserId); err != nil {
 		return errors.InternalServerError("users.updatepassword", err.Error())
 	}
 	return nil
 }
 
-func (s *Users) Login(ctx context.Context, req *pb.LoginRequest, rsp *pb.LoginResponse) error {
+func (s *Users) Login(ctx context.Context, req *pb.LoginRequest, rsp *pb.LoginResponse) (err error) {
+	d, err := s.domain(req.Tenant)
+	if err != nil {
+		return err
+	}
+	ev := newAuditEvent(ctx, domain.AuditLogin, methodPassword)
+	defer func() { s.auditLogin(d, ev, rsp.Session, rsp.Challenge, err) }()
+
+	if len(req.Challenge) > 0 {
+		ev.Method = methodCode
+		return s.loginWithCode(ctx, d, req, rsp, ev)
+	}
 	username := strings.ToLower(req.Username)
 	email := strings.ToLower(req.Email)
 
-	salt, hashed, err := s.domain.SaltAndPassword(username, email)
+	ip, _ := clientInfo(ctx)
+	if err := s.lockout.check(d, s.now(), "users.login", s.lockout.keys("", ip)...); err != nil {
+		return err
+	}
+
+	usr, err := d.Lookup(username, email)
+	if err == nil && usr.Deleted > 0 {
+		err = errors.NotFound("users.login", "User not found")
+	}
 	if err != nil {
+		// guessing usernames counts against the client address
+		s.lockout.fail(d, s.now(), s.lockout.keys("", ip)...)
 		return err
 	}
+	ev.UserID = usr.Id
 
-	hh, err := base64.StdEncoding.DecodeString(hashed)
+	keys := s.lockout.keys(usr.Id, ip)
+	if err := s.lockout.check(d, s.now(), "users.login", keys...); err != nil {
+		return err
+	}
+
+	salt, hashed, version, err := d.Password(usr.Id)
 	if err != nil {
-		return errors.InternalServerError("users.Login", err.Error())
+		return err
 	}
 
-	if err := bcrypt.CompareHashAndPassword(hh, []byte(x+salt+req.Password)); err != nil {
+	if err := s.hasher.verify(req.Password, salt, hashed, version); err != nil {
+		s.lockout.fail(d, s.now(), keys...)
 		return errors.Unauthorized("users.login", err.Error())
 	}
-	// save session
-	sess := &pb.Session{
-		Id:       random(128),
-		Username: username,
-		Email:    email,
-		Created:  time.Now().Unix(),
-		Expires:  time.Now().Add(time.Hour * 24 * 7).Unix(),
+
+	// migrate the hash to the current pepper and cost while we have the
+	// plaintext password, a failure here shouldn't fail the login
+	if s.hasher.needsRehash(hashed, version) {
+		if salt, pp, version, err := s.hasher.hash(req.Password); err != nil {
+			logger.Errorf("Error rehashing password of user %v: %v", usr.Id, err)
+		} else if err := d.UpdatePassword(usr.Id, salt, pp, version); err != nil {
+			logger.Errorf("Error saving rehashed password of user %v: %v", usr.Id, err)
+		}
+	}
+	if s.config.RequireVerification && !usr.Verified {
+		return errors.Forbidden("users.Login.Verified", "Email address has not been verified")
 	}
 
-	if err := s.domain.CreateSession(sess); err != nil {
-		return errors.InternalServerError("users.Login", err.Error())
+	sess, challenge, err := s.startSession(ctx, d, usr)
+	if err != nil {
+		return errors.InternalServerError("users.login", err.Error())
+	}
+	// failures are only cleared once the code is entered too, otherwise
+	// starting a new challenge would reset the count of guessed codes
+	if len(challenge) == 0 {
+		s.lockout.succeed(d, usr.Id)
+	}
+	if rsp.Token, err = s.token(d, sess); err != nil {
+		return errors.InternalServerError("users.login", err.Error())
 	}
 	rsp.Session = sess
+	rsp.Challenge = challenge
 	return nil
 }
 
-func (s *Users) Logout(ctx context.Context, req *pb.LogoutRequest, rsp *pb.LogoutResponse) error {
-	return s.domain.DeleteSession(req.SessionId)
+// startSession logs in a user who has proven who they are. Users with two
+// factor auth get a challenge to send back with a code instead of a session.
+func (s *Users) startSession(ctx context.Context, d *domain.Domain, usr *pb.User) (*pb.Session, string, error) {
+	tf, err := d.ReadTwoFactor(usr.Id)
+	if err != nil {
+		return nil, "", err
+	}
+	if tf != nil && tf.Enabled {
+		tok := random(32)
+		if err := d.CreateToken(domain.TokenTwoFactorChallenge, tok, usr.Id, s.now().Add(challengeExpiry)); err != nil {
+			return nil, "", err
+		}
+		return nil, tok, nil
+	}
+	sess, err := s.createSession(ctx, d, usr)
+	return sess, "", err
+}
+
+// createSession logs a user in on the device making the request
+func (s *Users) createSession(ctx context.Context, d *domain.Domain, usr *pb.User) (*pb.Session, error) {
+	sess, err := s.newSession(ctx, d, usr)
+	if err != nil {
+		return nil, err
+	}
+	return sess, d.CreateSession(sess)
+}
+
+// newSession returns a session of the user on the device making the request
+// without saving it
+func (s *Users) newSession(ctx context.Context, d *domain.Domain, usr *pb.User) (*pb.Session, error) {
+	if usr.Deleted > 0 {
+		return nil, domain.ErrUserDeleted
+	}
+	ip, ua := clientInfo(ctx)
+	id := random(128)
+	sess := &pb.Session{
+		Id:        id,
+		Handle:    domain.SessionHandle(id),
+		Username:  usr.Username,
+		Email:     usr.Email,
+		UserId:    usr.Id,
+		Created:   time.Now().Unix(),
+		Expires:   time.Now().Add(s.sessionTTL).Unix(),
+		Ip:        ip,
+		UserAgent: ua,
+	}
+	if err := withRoles(d, sess); err != nil {
+		return nil, err
+	}
+	return sess, nil
+}
+
+func (s *Users) Logout(ctx context.Context, req *pb.LogoutRequest, rsp *pb.LogoutResponse) (err error) {
+	d, err := s.domain(req.Tenant)
+	if err != nil {
+		return err
+	}
+	ev := newAuditEvent(ctx, domain.AuditLogout, "")
+	if sess, err := d.ReadSession(req.SessionId); err == nil {
+		ev.UserID = sess.UserId
+	}
+	defer func() { s.audit(d, ev, err) }()
+
+	return d.DeleteSession(req.SessionId)
 }
 
 func (s *Users) ReadSession(ctx context.Context, req *pb.ReadSessionRequest, rsp *pb.ReadSessionResponse) error {
-	sess, err := s.domain.ReadSession(req.SessionId)
+	d, err := s.domain(req.Tenant)
+	if err != nil {
+		return err
+	}
+	sess, err := d.ReadSession(req.SessionId)
+	if err == domain.ErrSessionExpired {
+		return errors.Unauthorized("users.ReadSession", err.Error())
+	}
 	if err != nil {
 		return err
 	}
+	if now := time.Now(); now.Sub(time.Unix(sess.LastSeen, 0)) > lastSeenInterval {
+		sess.LastSeen = now.Unix()
+		if err := d.UpdateSession(sess); err != nil {
+			logger.Errorf("Error updating last seen of session: %v", err)
+		}
+	}
+	if err := withRoles(d, sess); err != nil {
+		return errors.InternalServerError("users.ReadSession", err.Error())
+	}
 	rsp.Session = sess
 	return nil
 }
+
+func (s *Users) RefreshSession(ctx context.Context, req *pb.RefreshSessionRequest, rsp *pb.RefreshSessionResponse) error {
+	d, err := s.domain(req.Tenant)
+	if err != nil {
+		return err
+	}
+	sessionID := req.SessionId
+	if len(req.RefreshToken) > 0 {
+		// refresh tokens are single use, a new one is returned with the token
+		_, id, err := d.RedeemTokenWithData(domain.TokenRefresh, req.RefreshToken)
+		if err != nil {
+			return errors.Unauthorized("users.RefreshSession", err.Error())
+		}
+		sessionID = id
+	}
+	if len(sessionID) == 0 {
+		return errors.BadRequest("users.RefreshSession", "Missing session id or refresh token")
+	}
+	sess, err := d.ReadSession(sessionID)
+	if err == domain.ErrSessionExpired {
+		return errors.Unauthorized("users.RefreshSession", err.Error())
+	}
+	if err != nil {
+		return err
+	}
+
+	// slide the expiry forward but never past the maximum lifetime,
+	// impersonated sessions always end when they were meant to
+	expires := time.Now().Add(s.sessionTTL)
+	if max := time.Unix(sess.Created, 0).Add(s.sessionMaxLifetime); expires.After(max) {
+		expires = max
+	}
+	if expires.Unix() > sess.Expires && !impersonated(sess) {
+		sess.Expires = expires.Unix()
+	}
+	sess.LastSeen = time.Now().Unix()
+	if err := withRoles(d, sess); err != nil {
+		return errors.InternalServerError("users.RefreshSession", err.Error())
+	}
+	if err := d.UpdateSession(sess); err != nil {
+		return errors.InternalServerError("users.RefreshSession", err.Error())
+	}
+	if rsp.Token, err = s.token(d, sess); err != nil {
+		return errors.InternalServerError("users.RefreshSession", err.Error())
+	}
+	rsp.Session = sess
+	return nil
+}
+
+// sessionView returns a session without its id, which is the credential
+// the session is used with, so it can be shown to the user
+func sessionView(sess *pb.Session) *pb.Session {
+	v := proto.Clone(sess).(*pb.Session)
+	v.Id = ""
+	v.Handle = domain.SessionHandle(sess.Id)
+	return v
+}
+
+func (s *Users) ListSessions(ctx context.Context, req *pb.ListSessionsRequest, rsp *pb.ListSessionsResponse) error {
+	d, err := s.domain(req.Tenant)
+	if err != nil {
+		return err
+	}
+	if len(req.UserId) == 0 {
+		return errors.BadRequest("users.ListSessions", "Missing user id")
+	}
+	if _, err := callerSession(d, "users.ListSessions", req.SessionId, req.UserId); err != nil {
+		return err
+	}
+	sessions, err := d.ListSessions(req.UserId)
+	if err != nil {
+		return errors.InternalServerError("users.ListSessions", err.Error())
+	}
+	for _, sess := range sessions {
+		rsp.Sessions = append(rsp.Sessions, sessionView(sess))
+	}
+	return nil
+}
+
+func (s *Users) RevokeAllSessions(ctx context.Context, req *pb.RevokeAllSessionsRequest, rsp *pb.RevokeAllSessionsResponse) (err error) {
+	d, err := s.domain(req.Tenant)
+	if err != nil {
+		return err
+	}
+	ev := newAuditEvent(ctx, domain.AuditSessionsRevoked, "")
+	ev.UserID = req.UserId
+	defer func() { s.audit(d, ev, err) }()
+
+	if len(req.UserId) == 0 {
+		return errors.BadRequest("users.RevokeAllSessions", "Missing user id")
+	}
+	if _, err := callerSession(d, "users.RevokeAllSessions", req.SessionId, req.UserId); err != nil {
+		return err
+	}
+	if err := d.DeleteSessions(req.UserId); err != nil {
+		return errors.InternalServerError("users.RevokeAllSessions", err.Error())
+	}
+	return nil
+}
+
+// RevokeSession ends one of the other sessions of the caller's user
+func (s *Users) RevokeSession(ctx context.Context, req *pb.RevokeSessionRequest, rsp *pb.RevokeSessionResponse) (err error) {
+	d, err := s.domain(req.Tenant)
+	if err != nil {
+		return err
+	}
+	ev := newAuditEvent(ctx, domain.AuditSessionsRevoked, "")
+	defer func() { s.audit(d, ev, err) }()
+
+	if len(req.SessionId) == 0 {
+		return errors.Unauthorized("users.RevokeSession", "Missing session id")
+	}
+	if len(req.Handle) == 0 {
+		return errors.BadRequest("users.RevokeSession", "Missing session handle")
+	}
+	caller, err := d.ReadSession(req.SessionId)
+	if err != nil {
+		return errors.Unauthorized("users.RevokeSession", "Invalid session")
+	}
+	ev.UserID = caller.UserId
+	sessions, err := d.ListSessions(caller.UserId)
+	if err != nil {
+		return errors.InternalServerError("users.RevokeSession", err.Error())
+	}
+	for _, sess := range sessions {
+		if domain.SessionHandle(sess.Id) != req.Handle {
+			continue
+		}
+		if err := d.DeleteSession(sess.Id); err != nil {
+			return errors.InternalServerError("users.RevokeSession", err.Error())
+		}
+		return nil
+	}
+	return errors.NotFound("users.RevokeSession", "Session not found")
+}
+
+func (s *Users) Verify(ctx context.Context, req *pb.VerifyRequest, rsp *pb.VerifyResponse) error {
+	d, err := s.domain(req.Tenant)
+	if err != nil {
+		return err
+	}
+	if len(req.Token) == 0 {
+		return errors.BadRequest("users.Verify", "Missing token")
+	}
+	userID, err := d.RedeemToken(domain.TokenVerification, req.Token)
+	if err != nil {
+		return errors.BadRequest("users.Verify", err.Error())
+	}
+	usr, err := d.Read(userID)
+	if err != nil {
+		return errors.InternalServerError("users.Verify", err.Error())
+	}
+	if usr.Verified {
+		return nil
+	}
+	usr.Verified = true
+	if err := d.Update(usr); err != nil {
+		return errors.InternalServerError("users.Verify", err.Error())
+	}
+	publishVerified(d, usr)
+	return nil
+}
+
+func (s *Users) ResendVerification(ctx context.Context, req *pb.ResendVerificationRequest, rsp *pb.ResendVerificationResponse) error {
+	d, err := s.domain(req.Tenant)
+	if err != nil {
+		return err
+	}
+	if len(req.Email) == 0 {
+		return errors.BadRequest("users.ResendVerification", "Missing email")
+	}
+	usr, err := d.Lookup("", strings.ToLower(req.Email))
+	if err != nil || usr.Deleted > 0 {
+		return errors.NotFound("users.ResendVerification", "User not found")
+	}
+	if usr.Verified {
+		return errors.BadRequest("users.ResendVerification", "Email address is already verified")
+	}
+	if err := s.sendVerification(ctx, d, usr); err != nil {
+		return errors.InternalServerError("users.ResendVerification", err.Error())
+	}
+	return nil
+}
+
+func (s *Users) RequestPasswordReset(ctx context.Context, req *pb.RequestPasswordResetRequest, rsp *pb.RequestPasswordResetResponse) error {
+	d, err := s.domain(req.Tenant)
+	if err != nil {
+		return err
+	}
+	if len(req.Email) == 0 {
+		return errors.BadRequest("users.RequestPasswordReset", "Missing email")
+	}
+	usr, err := d.Lookup("", strings.ToLower(req.Email))
+	if err != nil || usr.Deleted > 0 {
+		// don't reveal whether an account exists for the address
+		logger.Infof("Password reset requested for unknown email")
+		return nil
+	}
+	tok := random(32)
+	if err := d.CreateToken(domain.TokenPasswordReset, tok, usr.Id, time.Now().Add(passwordResetExpiry)); err != nil {
+		return errors.InternalServerError("users.RequestPasswordReset", err.Error())
+	}
+	if err := s.sendEmail(ctx, usr.Email, s.config.Sendgrid.PasswordResetTemplateID, map[string]interface{}{
+		"username": usr.Username,
+		"token":    tok,
+		"tenant":   d.Tenant(),
+	}); err != nil {
+		return errors.InternalServerError("users.RequestPasswordReset", err.Error())
+	}
+	return nil
+}
+
+func (s *Users) ResetPassword(ctx context.Context, req *pb.ResetPasswordRequest, rsp *pb.ResetPasswordResponse) (err error) {
+	d, err := s.domain(req.Tenant)
+	if err != nil {
+		return err
+	}
+	ev := newAuditEvent(ctx, domain.AuditPasswordReset, methodResetToken)
+	defer func() { s.audit(d, ev, err) }()
+
+	if len(req.Token) == 0 {
+		return errors.BadRequest("users.ResetPassword", "Missing token")
+	}
+	var errs fieldErrors
+	s.policy(req.Tenant).password(&errs, fieldNewPassword, req.NewPassword)
+	if req.NewPassword != req.ConfirmPassword {
+		errs.add(fieldConfirmPassword, codeMismatch, "Passwords don't match")
+	}
+	if err := errs.err("users.ResetPassword"); err != nil {
+		return err
+	}
+	userID, err := d.RedeemToken(domain.TokenPasswordReset, req.Token)
+	if err != nil {
+		return errors.BadRequest("users.ResetPassword", err.Error())
+	}
+	ev.UserID = userID
+
+	salt, pp, version, err := s.hasher.hash(req.NewPassword)
+	if err != nil {
+		return errors.InternalServerError("users.ResetPassword", err.Error())
+	}
+	if err := d.UpdatePassword(userID, salt, pp, version); err != nil {
+		return errors.InternalServerError("users.ResetPassword", err.Error())
+	}
+
+	// any other reset links and every existing session are now void
+	if err := d.DeleteTokens(domain.TokenPasswordReset, userID); err != nil {
+		return errors.InternalServerError("users.ResetPassword", err.Error())
+	}
+	if err := d.DeleteSessions(userID); err != nil {
+		return errors.InternalServerError("users.ResetPassword", err.Error())
+	}
+	return nil
+}
+
+// sendVerification issues a new verification token for the user and emails
+// it to them
+func (s *Users) sendVerification(ctx context.Context, d *domain.Domain, usr *pb.User) error {
+	tok := random(32)
+	if err := d.CreateToken(domain.TokenVerification, tok, usr.Id, time.Now().Add(verificationExpiry)); err != nil {
+		return err
+	}
+	return s.sendEmail(ctx, usr.Email, s.config.Sendgrid.VerificationTemplateID, map[string]interface{}{
+		"username": usr.Username,
+		"token":    tok,
+		"tenant":   d.Tenant(),
+	})
+}
+
+func (s *Users) sendEmail(ctx context.Context, to, templateID string, data map[string]interface{}) error {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	_, err = s.emailService.Send(ctx, &eproto.SendRequest{
+		To:           to,
+		TemplateId:   templateID,
+		TemplateData: b,
+	})
+	return err
+}
@@ -0,0 +1,104 @@
+package handler
+
+import (
+	"time"
+
+	"github.com/embedscript/backend/users/domain"
+	pb "github.com/embedscript/backend/users/proto"
+	"github.com/micro/micro/v3/service/errors"
+	"golang.org/x/net/context"
+)
+
+const (
+	// permissionImpersonate is needed on user/<id> to impersonate a user
+	permissionImpersonate = "users.impersonate"
+
+	defaultImpersonationTTL = time.Hour
+)
+
+type impersonationConf struct {
+	// how long an impersonated session lasts, eg. "1h"
+	TTL string `json:"ttl"`
+}
+
+// Impersonate signs an admin in as another user, eg. so support staff can see
+// what they see. Every attempt is recorded in the user's audit log along with
+// the admin's id.
+func (s *Users) Impersonate(ctx context.Context, req *pb.ImpersonateRequest, rsp *pb.ImpersonateResponse) (err error) {
+	d, err := s.domain(req.Tenant)
+	if err != nil {
+		return err
+	}
+	ev := newAuditEvent(ctx, domain.AuditImpersonate, "")
+	ev.UserID = req.UserId
+	defer func() { s.audit(d, ev, err) }()
+
+	if len(req.SessionId) == 0 {
+		return errors.Unauthorized("users.Impersonate", "Missing session id")
+	}
+	if len(req.UserId) == 0 {
+		return errors.BadRequest("users.Impersonate", "Missing user id")
+	}
+	admin, err := d.ReadSession(req.SessionId)
+	if err != nil {
+		return errors.Unauthorized("users.Impersonate", "Invalid session")
+	}
+	ev.ActorID = admin.UserId
+	if len(admin.ImpersonatorId) > 0 {
+		return errors.Forbidden("users.Impersonate", "Impersonated sessions can't impersonate")
+	}
+	if admin.UserId == req.UserId {
+		return errors.BadRequest("users.Impersonate", "Can't impersonate yourself")
+	}
+	g, err := d.ReadGrants(admin.UserId)
+	if err != nil {
+		return errors.InternalServerError("users.Impersonate", err.Error())
+	}
+	ok, err := d.Authorize(g, permissionImpersonate, "user/"+req.UserId)
+	if err != nil {
+		return errors.InternalServerError("users.Impersonate", err.Error())
+	}
+	if !ok {
+		return errors.Forbidden("users.Impersonate", "Not allowed to impersonate this user")
+	}
+	usr, err := d.Read(req.UserId)
+	if err != nil || usr.Deleted > 0 {
+		return errors.NotFound("users.Impersonate", "User not found")
+	}
+
+	sess, err := s.newSession(ctx, d, usr)
+	if err != nil {
+		return errors.InternalServerError("users.Impersonate", err.Error())
+	}
+	sess.Expires = time.Now().Add(s.impersonationTTL).Unix()
+	sess.ImpersonatorId = admin.UserId
+	if err := d.CreateSession(sess); err != nil {
+		return errors.InternalServerError("users.Impersonate", err.Error())
+	}
+	if rsp.Token, err = s.token(d, sess); err != nil {
+		return errors.InternalServerError("users.Impersonate", err.Error())
+	}
+	rsp.Session = sess
+	return nil
+}
+
+// callerSession reads the session a request was made with, which has to be
+// a session of the user the request is about
+func callerSession(d *domain.Domain, id, sessionID, userID string) (*pb.Session, error) {
+	if len(sessionID) == 0 {
+		return nil, errors.Unauthorized(id, "Missing session id")
+	}
+	sess, err := d.ReadSession(sessionID)
+	if err != nil {
+		return nil, errors.Unauthorized(id, "Invalid session")
+	}
+	if sess.UserId != userID {
+		return nil, errors.Forbidden(id, "Session belongs to another user")
+	}
+	return sess, nil
+}
+
+// impersonated reports whether a session was started by Impersonate
+func impersonated(sess *pb.Session) bool {
+	return sess != nil && len(sess.ImpersonatorId) > 0
+}
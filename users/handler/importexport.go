@@ -0,0 +1,443 @@
+package handler
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/embedscript/backend/users/domain"
+	pb "github.com/embedscript/backend/users/proto"
+	"github.com/google/uuid"
+	"github.com/micro/micro/v3/service/errors"
+	"golang.org/x/net/context"
+)
+
+const (
+	formatJSONLines = "jsonl"
+	formatCSV       = "csv"
+
+	// longest line read from a JSON lines import
+	maxImportLine = 1024 * 1024
+	// users sent at a time while exporting
+	exportPage = 100
+
+	// permissionImport and permissionExport are needed on user/* to import
+	// or export users
+	permissionImport = "users.import"
+	permissionExport = "users.export"
+)
+
+// csvColumns are the columns of an exported csv file, imports can have them
+// in any order and leave out all but email
+var csvColumns = []string{"id", "username", "email", "verified", "displayName", "avatarUrl", "metadata", "created", "passwordHash"}
+
+// importUser is a row of an import or export. The password hash is a bcrypt
+// or argon2id hash of the plain password, it's never exported.
+type importUser struct {
+	ID           string            `json:"id,omitempty"`
+	Username     string            `json:"username,omitempty"`
+	Email        string            `json:"email"`
+	Verified     bool              `json:"verified,omitempty"`
+	DisplayName  string            `json:"displayName,omitempty"`
+	AvatarURL    string            `json:"avatarUrl,omitempty"`
+	Metadata     map[string]string `json:"metadata,omitempty"`
+	Created      int64             `json:"created,omitempty"`
+	PasswordHash string            `json:"passwordHash,omitempty"`
+}
+
+// fromCSV reads a row of a csv file with the given header
+func (u *importUser) fromCSV(header, record []string) error {
+	for i, col := range header {
+		v := record[i]
+		if len(v) == 0 {
+			continue
+		}
+		switch col {
+		case "id":
+			u.ID = v
+		case "username":
+			u.Username = v
+		case "email":
+			u.Email = v
+		case "verified":
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return fmt.Errorf("verified must be true or false")
+			}
+			u.Verified = b
+		case "displayName":
+			u.DisplayName = v
+		case "avatarUrl":
+			u.AvatarURL = v
+		case "metadata":
+			if err := json.Unmarshal([]byte(v), &u.Metadata); err != nil {
+				return fmt.Errorf("metadata must be a JSON object of strings")
+			}
+		case "created":
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				return fmt.Errorf("created must be a unix time")
+			}
+			u.Created = n
+		case "passwordHash":
+			u.PasswordHash = v
+		}
+	}
+	return nil
+}
+
+// toCSV returns the user as a row with the columns in csvColumns
+func (u *importUser) toCSV() []string {
+	var metadata string
+	if len(u.Metadata) > 0 {
+		b, _ := json.Marshal(u.Metadata)
+		metadata = string(b)
+	}
+	var created string
+	if u.Created > 0 {
+		created = strconv.FormatInt(u.Created, 10)
+	}
+	return []string{
+		u.ID, u.Username, u.Email, strconv.FormatBool(u.Verified),
+		u.DisplayName, u.AvatarURL, metadata, created, u.PasswordHash,
+	}
+}
+
+// importReader reads the file sent in chunks over an import stream
+type importReader struct {
+	stream pb.Users_ImportStream
+	buf    []byte
+}
+
+func (r *importReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		req, err := r.stream.Recv()
+		if err != nil {
+			return 0, err
+		}
+		r.buf = req.Data
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+// importRow is a row of an import and its number. Rows that can't be
+// parsed have an error instead of a user.
+type importRow struct {
+	line int64
+	user *importUser
+	err  error
+}
+
+// rowReader returns the rows of an import one at a time, io.EOF ends the
+// file. The rest of the file is still read after a row that can't be parsed.
+type rowReader func() (*importRow, error)
+
+func jsonLinesReader(r io.Reader) rowReader {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), maxImportLine)
+	var line int64
+	return func() (*importRow, error) {
+		for sc.Scan() {
+			line++
+			b := bytes.TrimSpace(sc.Bytes())
+			if len(b) == 0 {
+				continue
+			}
+			u := &importUser{}
+			if err := json.Unmarshal(b, u); err != nil {
+				return &importRow{line: line, err: fmt.Errorf("invalid JSON: %v", err)}, nil
+			}
+			return &importRow{line: line, user: u}, nil
+		}
+		if err := sc.Err(); err != nil {
+			return nil, err
+		}
+		return nil, io.EOF
+	}
+}
+
+func csvReader(r io.Reader) (rowReader, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err == io.EOF {
+		return func() (*importRow, error) { return nil, io.EOF }, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	known := map[string]bool{}
+	for _, col := range csvColumns {
+		known[col] = true
+	}
+	for i, col := range header {
+		col = strings.TrimSpace(col)
+		if !known[col] {
+			return nil, fmt.Errorf("unknown column %q", col)
+		}
+		header[i] = col
+	}
+	// rows are counted like a spreadsheet would, the header is row 1
+	line := int64(1)
+	return func() (*importRow, error) {
+		record, err := cr.Read()
+		if err == io.EOF {
+			return nil, err
+		}
+		line++
+		if perr, ok := err.(*csv.ParseError); ok {
+			return &importRow{line: line, err: perr.Err}, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		row := &importRow{line: line}
+		if len(record) != len(header) {
+			row.err = fmt.Errorf("expected %v columns, got %v", len(header), len(record))
+			return row, nil
+		}
+		row.user = &importUser{}
+		if err := row.user.fromCSV(header, record); err != nil {
+			row.user, row.err = nil, err
+		}
+		return row, nil
+	}, nil
+}
+
+// Import creates users from a JSON lines or csv file, eg. exported from
+// another provider. Password hashes are kept so users can sign in with
+// their existing password, it's rehashed with the pepper on their next
+// login. Every row is validated like Create, rows that fail are reported
+// and skipped.
+func (s *Users) Import(ctx context.Context, stream pb.Users_ImportStream) error {
+	first, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	// only trusted accounts can import into a new tenant, anyone else needs
+	// a session in an existing one
+	var d *domain.Domain
+	if trusted(ctx) {
+		d, err = s.createDomain(first.Tenant)
+	} else {
+		d, err = s.domain(first.Tenant)
+	}
+	if err != nil {
+		return err
+	}
+	if err := s.authorize(ctx, d, "users.Import", first.SessionId, permissionImport, "user/*"); err != nil {
+		return err
+	}
+	r := &importReader{stream: stream, buf: first.Data}
+
+	var next rowReader
+	switch first.Format {
+	case "", formatJSONLines:
+		next = jsonLinesReader(r)
+	case formatCSV:
+		if next, err = csvReader(r); err != nil {
+			return errors.BadRequest("users.Import", "Invalid csv header: %v", err)
+		}
+	default:
+		return errors.BadRequest("users.Import", "Unknown format %q", first.Format)
+	}
+
+	seen := map[string]bool{}
+	summary := &pb.ImportResponse{Done: true}
+	for {
+		row, err := next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return errors.InternalServerError("users.Import", err.Error())
+		}
+		rsp := &pb.ImportResponse{Row: row.line}
+		if row.err == nil {
+			row.err = s.importUser(d, row.user, seen, first.DryRun, rsp)
+		}
+		if row.err != nil {
+			rsp.Error = row.err.Error()
+			if errs, ok := row.err.(fieldErrors); ok {
+				rsp.FieldErrors = errs
+			}
+			summary.Failed++
+		} else {
+			summary.Imported++
+		}
+		if err := stream.Send(rsp); err != nil {
+			return err
+		}
+	}
+	return stream.Send(summary)
+}
+
+// importUser validates a row and creates the user unless it's a dry run.
+// Ids, usernames and emails seen earlier in the file are treated as taken.
+func (s *Users) importUser(d *domain.Domain, u *importUser, seen map[string]bool, dryRun bool, rsp *pb.ImportResponse) error {
+	usr := &pb.User{
+		Id:          u.ID,
+		Username:    strings.ToLower(u.Username),
+		Email:       strings.ToLower(u.Email),
+		Verified:    u.Verified,
+		DisplayName: u.DisplayName,
+		AvatarUrl:   u.AvatarURL,
+		Metadata:    u.Metadata,
+		Created:     u.Created,
+	}
+	if len(usr.Id) == 0 {
+		usr.Id = uuid.New().String()
+	}
+	rsp.Id = usr.Id
+
+	p := s.policy(d.Tenant())
+	var errs fieldErrors
+	if len(usr.Email) == 0 {
+		errs.add(fieldEmail, codeRequired, "%v is required", fieldEmail)
+	}
+	if len(usr.Username) > 0 {
+		p.username(&errs, usr.Username)
+	}
+	s.profile.validate(&errs, usr)
+	if len(errs) > 0 {
+		return errs
+	}
+
+	var salt, pp string
+	var version int
+	var err error
+	if len(u.PasswordHash) > 0 {
+		salt, pp, version, err = importHash(u.PasswordHash)
+		if err != nil {
+			return fmt.Errorf("passwordHash must be a bcrypt or argon2id hash")
+		}
+	}
+
+	if seen["id:"+usr.Id] {
+		return fmt.Errorf("id is used by an earlier row")
+	}
+	if _, err := d.Read(usr.Id); err == nil {
+		return fmt.Errorf("user already exists")
+	}
+	if seen["email:"+usr.Email] {
+		return fmt.Errorf("email is used by an earlier row")
+	}
+	if taken, err := d.Taken("", usr.Email, usr.Id); err != nil {
+		return err
+	} else if taken {
+		return fmt.Errorf("email is already in use")
+	}
+	if len(usr.Username) == 0 {
+		if usr.Username, err = availableUsername(d, p, "", usr.Email); err != nil {
+			return err
+		}
+	} else if taken, err := d.Taken(usr.Username, "", usr.Id); err != nil {
+		return err
+	} else if taken {
+		return fmt.Errorf("username is already in use")
+	}
+	if seen["username:"+usr.Username] {
+		return fmt.Errorf("username is used by an earlier row")
+	}
+	rsp.Username = usr.Username
+	seen["id:"+usr.Id] = true
+	seen["email:"+usr.Email] = true
+	seen["username:"+usr.Username] = true
+	if dryRun {
+		return nil
+	}
+
+	// users without a hash get a random password they can reset
+	if len(pp) == 0 {
+		if salt, pp, version, err = s.hasher.hash(random(32)); err != nil {
+			return err
+		}
+	}
+	if err := d.Create(usr, salt, pp, version); err != nil {
+		return err
+	}
+	publishCreated(d, usr)
+	return nil
+}
+
+// Export streams the active users of a tenant in the format Import reads,
+// a chunk of users at a time
+func (s *Users) Export(ctx context.Context, req *pb.ExportRequest, stream pb.Users_ExportStream) error {
+	d, err := s.domain(req.Tenant)
+	if err != nil {
+		return err
+	}
+	if err := s.authorize(ctx, d, "users.Export", req.SessionId, permissionExport, "user/*"); err != nil {
+		return err
+	}
+	switch req.Format {
+	case "", formatJSONLines, formatCSV:
+	default:
+		return errors.BadRequest("users.Export", "Unknown format %q", req.Format)
+	}
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	if req.Format == formatCSV {
+		// the password hash is left out
+		w.Write(csvColumns[:len(csvColumns)-1])
+	}
+	send := func() error {
+		w.Flush()
+		if err := w.Error(); err != nil {
+			return err
+		}
+		if buf.Len() == 0 {
+			return nil
+		}
+		if err := stream.Send(&pb.ExportResponse{Data: buf.Bytes()}); err != nil {
+			return err
+		}
+		buf = bytes.Buffer{}
+		w = csv.NewWriter(&buf)
+		return nil
+	}
+
+	// the users are read in a single pass, sending a chunk every page
+	n := 0
+	err = d.ScanUsers(func(usr *pb.User) error {
+		u := &importUser{
+			ID:          usr.Id,
+			Username:    usr.Username,
+			Email:       usr.Email,
+			Verified:    usr.Verified,
+			DisplayName: usr.DisplayName,
+			AvatarURL:   usr.AvatarUrl,
+			Metadata:    usr.Metadata,
+			Created:     usr.Created,
+		}
+		if req.Format == formatCSV {
+			row := u.toCSV()
+			w.Write(row[:len(row)-1])
+		} else {
+			b, err := json.Marshal(u)
+			if err != nil {
+				return err
+			}
+			buf.Write(append(b, '\n'))
+		}
+		if n++; n%exportPage == 0 {
+			return send()
+		}
+		return nil
+	})
+	if err == nil {
+		err = send()
+	}
+	if err != nil {
+		return errors.InternalServerError("users.Export", err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+package handler
+
+import (
+	"strings"
+
+	"github.com/embedscript/backend/users/domain"
+	pb "github.com/embedscript/backend/users/proto"
+	"github.com/micro/micro/v3/service/errors"
+	"golang.org/x/net/context"
+)
+
+const (
+	fieldInviteCode = "inviteCode"
+
+	// inviteCodeLength is the length of generated codes, they're uppercase
+	// so they're easy to type
+	inviteCodeLength = 12
+
+	// permissionInvites is needed on invites to create, list or revoke them
+	permissionInvites = "users.invites"
+)
+
+func fromInvite(inv *domain.Invite) *pb.Invite {
+	return &pb.Invite{
+		Code:    inv.ID,
+		Email:   inv.Email,
+		MaxUses: inv.MaxUses,
+		Uses:    inv.Uses,
+		Created: inv.Created,
+		Expires: inv.Expires,
+	}
+}
+
+// checkInvite returns the invite if the code lets the email sign up, and
+// adds a field error if it doesn't
+func (s *Users) checkInvite(errs *fieldErrors, d *domain.Domain, code, email string) (*domain.Invite, error) {
+	if len(code) == 0 {
+		errs.add(fieldInviteCode, codeRequired, "An invite code is required to sign up")
+		return nil, nil
+	}
+	inv, err := d.CheckInvite(code, email, s.now())
+	if err != nil {
+		return nil, inviteError(errs, err)
+	}
+	return inv, nil
+}
+
+// useInvite takes a use of an invite right before a user is created with it,
+// checking it again in case it was used up or revoked since it was checked
+func (s *Users) useInvite(d *domain.Domain, id, code, email string) error {
+	if _, err := d.UseInvite(code, email, s.now()); err != nil {
+		var errs fieldErrors
+		if err := inviteError(&errs, err); err != nil {
+			return errors.InternalServerError(id, err.Error())
+		}
+		return errs.err(id)
+	}
+	return nil
+}
+
+// inviteError adds the field error of an invite that can't be used, other
+// errors are returned
+func inviteError(errs *fieldErrors, err error) error {
+	switch err {
+	case domain.ErrInviteInvalid, domain.ErrInviteEmail:
+		errs.add(fieldInviteCode, codeInvalid, "Invite code is invalid")
+	case domain.ErrInviteExpired:
+		errs.add(fieldInviteCode, codeExpired, "Invite code has expired")
+	case domain.ErrInviteUsedUp:
+		errs.add(fieldInviteCode, codeUsedUp, "Invite code has been used up")
+	default:
+		return err
+	}
+	return nil
+}
+
+func (s *Users) CreateInvite(ctx context.Context, req *pb.CreateInviteRequest, rsp *pb.CreateInviteResponse) error {
+	d, err := s.domain(req.Tenant)
+	if err != nil {
+		return err
+	}
+	if err := s.authorize(ctx, d, "users.CreateInvite", req.SessionId, permissionInvites, "invites"); err != nil {
+		return err
+	}
+	if req.MaxUses < 0 {
+		return errors.BadRequest("users.CreateInvite", "Max uses can't be negative")
+	}
+	if req.Expires != 0 && req.Expires <= s.now().Unix() {
+		return errors.BadRequest("users.CreateInvite", "Expiry is in the past")
+	}
+	inv := &domain.Invite{
+		ID:      strings.ToUpper(random(inviteCodeLength)),
+		Email:   strings.ToLower(req.Email),
+		MaxUses: req.MaxUses,
+		Created: s.now().Unix(),
+		Expires: req.Expires,
+	}
+	if err := d.SaveInvite(inv); err != nil {
+		return errors.InternalServerError("users.CreateInvite", err.Error())
+	}
+	rsp.Invite = fromInvite(inv)
+	return nil
+}
+
+func (s *Users) ListInvites(ctx context.Context, req *pb.ListInvitesRequest, rsp *pb.ListInvitesResponse) error {
+	d, err := s.domain(req.Tenant)
+	if err != nil {
+		return err
+	}
+	if err := s.authorize(ctx, d, "users.ListInvites", req.SessionId, permissionInvites, "invites"); err != nil {
+		return err
+	}
+	limit, offset := pageOf(req.Limit, req.Offset)
+	invites, err := d.ListInvites(limit, offset)
+	if err != nil {
+		return errors.InternalServerError("users.ListInvites", err.Error())
+	}
+	for _, inv := range invites {
+		rsp.Invites = append(rsp.Invites, fromInvite(inv))
+	}
+	return nil
+}
+
+// RevokeInvite deletes an invite, users who signed up with it are kept
+func (s *Users) RevokeInvite(ctx context.Context, req *pb.RevokeInviteRequest, rsp *pb.RevokeInviteResponse) error {
+	d, err := s.domain(req.Tenant)
+	if err != nil {
+		return err
+	}
+	if err := s.authorize(ctx, d, "users.RevokeInvite", req.SessionId, permissionInvites, "invites"); err != nil {
+		return err
+	}
+	if len(req.Code) == 0 {
+		return errors.BadRequest("users.RevokeInvite", "Missing invite code")
+	}
+	if err := d.DeleteInvite(req.Code); err != nil {
+		return errors.InternalServerError("users.RevokeInvite", err.Error())
+	}
+	return nil
+}
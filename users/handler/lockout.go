@@ -0,0 +1,179 @@
+package handler
+
+import (
+	"math"
+	"strings"
+	"time"
+
+	"github.com/embedscript/backend/users/domain"
+	pb "github.com/embedscript/backend/users/proto"
+	"github.com/micro/micro/v3/service/errors"
+	"github.com/micro/micro/v3/service/logger"
+	"golang.org/x/net/context"
+)
+
+const (
+	// statusLocked is returned while an account or address is locked out
+	statusLocked = 423
+	// statusTooManyAttempts is returned while backing off between attempts
+	statusTooManyAttempts = 429
+
+	defaultLockoutThreshold   = 10
+	defaultIPLockoutThreshold = 50
+	defaultLockoutDuration    = 15 * time.Minute
+	defaultLockoutBackoff     = time.Second
+	defaultLockoutWindow      = time.Hour
+
+	// permissionUnlock is needed on user/<id> or ip/<address> to unlock it
+	permissionUnlock = "users.unlock"
+)
+
+type lockoutConf struct {
+	// failed attempts against an account before it's locked
+	Threshold int `json:"threshold"`
+	// failed attempts from a client address before it's locked
+	IPThreshold int `json:"ip_threshold"`
+	// how long a lockout lasts, eg. "15m"
+	Duration string `json:"duration"`
+	// delay after the first failure, doubled with every failure after, eg. "1s"
+	Backoff string `json:"backoff"`
+	// failures are forgotten after this long without another, eg. "1h"
+	Window string `json:"window"`
+}
+
+// lockout slows down and then locks out repeated failed password attempts
+// against an account or from a client address
+type lockout struct {
+	threshold   int
+	ipThreshold int
+	duration    time.Duration
+	backoff     time.Duration
+	window      time.Duration
+}
+
+func newLockout(c lockoutConf) *lockout {
+	l := &lockout{
+		threshold:   c.Threshold,
+		ipThreshold: c.IPThreshold,
+		duration:    parseDuration("lockout.duration", c.Duration, defaultLockoutDuration),
+		backoff:     parseDuration("lockout.backoff", c.Backoff, defaultLockoutBackoff),
+		window:      parseDuration("lockout.window", c.Window, defaultLockoutWindow),
+	}
+	if l.threshold <= 0 {
+		l.threshold = defaultLockoutThreshold
+	}
+	if l.ipThreshold <= 0 {
+		l.ipThreshold = defaultIPLockoutThreshold
+	}
+	return l
+}
+
+// keys returns the attempts keys of an account and the client address,
+// either may be blank
+func (l *lockout) keys(userID, ip string) []string {
+	var keys []string
+	if len(userID) > 0 {
+		keys = append(keys, domain.AccountKey(userID))
+	}
+	if len(ip) > 0 {
+		keys = append(keys, domain.AddressKey(ip))
+	}
+	return keys
+}
+
+// delay is how long to wait after the given number of failures
+func (l *lockout) delay(failures int) time.Duration {
+	if failures == 0 {
+		return 0
+	}
+	d := time.Duration(float64(l.backoff) * math.Pow(2, float64(failures-1)))
+	if d > l.duration || d <= 0 {
+		return l.duration
+	}
+	return d
+}
+
+// check returns an error if any of the keys is locked or backing off
+func (l *lockout) check(d *domain.Domain, now time.Time, id string, keys ...string) error {
+	for _, key := range keys {
+		a, err := d.ReadAttempts(key)
+		if err != nil {
+			return errors.InternalServerError(id, err.Error())
+		}
+		if a.LockedUntil > now.Unix() {
+			return errors.New(id, "Too many failed attempts, locked until "+time.Unix(a.LockedUntil, 0).UTC().Format(time.RFC3339), statusLocked)
+		}
+		if now.Sub(time.Unix(a.LastFailure, 0)) > l.window {
+			continue
+		}
+		if wait := time.Unix(a.LastFailure, 0).Add(l.delay(a.Failures)).Sub(now); wait > 0 {
+			return errors.New(id, "Too many failed attempts, try again in "+wait.Round(time.Second).String(), statusTooManyAttempts)
+		}
+	}
+	return nil
+}
+
+// fail records a failed attempt against each of the keys
+func (l *lockout) fail(d *domain.Domain, now time.Time, keys ...string) {
+	for _, key := range keys {
+		a, err := d.ReadAttempts(key)
+		if err != nil {
+			logger.Errorf("Error reading attempts of %v: %v", key, err)
+			continue
+		}
+		if now.Sub(time.Unix(a.LastFailure, 0)) > l.window {
+			a.Failures = 0
+		}
+		a.Failures++
+		a.LastFailure = now.Unix()
+
+		threshold := l.threshold
+		if strings.HasPrefix(key, domain.AddressKey("")) {
+			threshold = l.ipThreshold
+		}
+		if a.Failures >= threshold {
+			a.LockedUntil = now.Add(l.duration).Unix()
+			a.Failures = 0
+			logger.Infof("Locked out %v until %v", key, time.Unix(a.LockedUntil, 0))
+		}
+		if err := d.SaveAttempts(a); err != nil {
+			logger.Errorf("Error saving attempts of %v: %v", key, err)
+		}
+	}
+}
+
+// succeed clears the failed attempts against an account. Attempts from the
+// client address are kept, otherwise signing in to one account would reset
+// the count while guessing passwords of others.
+func (l *lockout) succeed(d *domain.Domain, userID string) {
+	if err := d.DeleteAttempts(domain.AccountKey(userID)); err != nil {
+		logger.Errorf("Error clearing attempts of user %v: %v", userID, err)
+	}
+}
+
+func (s *Users) Unlock(ctx context.Context, req *pb.UnlockRequest, rsp *pb.UnlockResponse) error {
+	d, err := s.domain(req.Tenant)
+	if err != nil {
+		return err
+	}
+	keys := s.lockout.keys(req.UserId, req.Ip)
+	if len(keys) == 0 {
+		return errors.BadRequest("users.Unlock", "Missing user id or ip")
+	}
+	if len(req.UserId) > 0 {
+		if err := s.authorize(ctx, d, "users.Unlock", req.SessionId, permissionUnlock, "user/"+req.UserId); err != nil {
+			return err
+		}
+	}
+	if len(req.Ip) > 0 {
+		if err := s.authorize(ctx, d, "users.Unlock", req.SessionId, permissionUnlock, "ip/"+req.Ip); err != nil {
+			return err
+		}
+	}
+	for _, key := range keys {
+		if err := d.DeleteAttempts(key); err != nil {
+			return errors.InternalServerError("users.Unlock", err.Error())
+		}
+	}
+	return nil
+}
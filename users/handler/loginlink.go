@@ -0,0 +1,120 @@
+package handler
+
+import (
+	"strings"
+	"time"
+
+	"github.com/embedscript/backend/users/domain"
+	pb "github.com/embedscript/backend/users/proto"
+	"github.com/micro/micro/v3/service/errors"
+	"github.com/micro/micro/v3/service/logger"
+	"golang.org/x/net/context"
+)
+
+const defaultLoginLinkExpiry = 15 * time.Minute
+
+type loginLinkConf struct {
+	// create an account for an unknown email on first use, can be
+	// overridden per tenant with tenants.<id>.login_link_signup
+	Signup bool `json:"signup"`
+	// how long a link is valid for, eg. "15m"
+	Expiry string `json:"expiry"`
+}
+
+func (s *Users) SendLoginLink(ctx context.Context, req *pb.SendLoginLinkRequest, rsp *pb.SendLoginLinkResponse) error {
+	d, err := s.domain(req.Tenant)
+	if err != nil {
+		return err
+	}
+	email := strings.ToLower(strings.TrimSpace(req.Email))
+	if len(email) == 0 {
+		return errors.BadRequest("users.SendLoginLink", "Missing email")
+	}
+
+	// the token carries the email so an account can be created for it when
+	// it's redeemed, the user id is only set if there already is one
+	var userID, username string
+	usr, err := d.Lookup("", email)
+	switch {
+	case err == nil && usr.Deleted == 0:
+		userID, username = usr.Id, usr.Username
+	case err == nil || !s.loginLinkSignup(d.Tenant()):
+		// don't reveal whether an account exists for the address
+		logger.Infof("Login link requested for unknown email")
+		return nil
+	}
+
+	tok := random(32)
+	if err := d.CreateTokenWithData(domain.TokenLoginLink, tok, userID, email, time.Now().Add(s.loginLinkExpiry)); err != nil {
+		return errors.InternalServerError("users.SendLoginLink", err.Error())
+	}
+	if err := s.sendEmail(ctx, email, s.config.Sendgrid.LoginLinkTemplateID, map[string]interface{}{
+		"username": username,
+		"token":    tok,
+		"tenant":   d.Tenant(),
+	}); err != nil {
+		return errors.InternalServerError("users.SendLoginLink", err.Error())
+	}
+	return nil
+}
+
+func (s *Users) RedeemLoginLink(ctx context.Context, req *pb.RedeemLoginLinkRequest, rsp *pb.RedeemLoginLinkResponse) (err error) {
+	d, err := s.domain(req.Tenant)
+	if err != nil {
+		return err
+	}
+	ev := newAuditEvent(ctx, domain.AuditLogin, methodLoginLink)
+	defer func() { s.auditLogin(d, ev, rsp.Session, rsp.Challenge, err) }()
+
+	if len(req.Token) == 0 {
+		return errors.BadRequest("users.RedeemLoginLink", "Missing token")
+	}
+	userID, email, err := d.RedeemTokenWithData(domain.TokenLoginLink, req.Token)
+	if err != nil {
+		return errors.BadRequest("users.RedeemLoginLink", err.Error())
+	}
+
+	var usr *pb.User
+	if len(userID) > 0 {
+		usr, err = d.Read(userID)
+		if err != nil {
+			return errors.InternalServerError("users.RedeemLoginLink", err.Error())
+		}
+		if usr.Email != email {
+			return errors.BadRequest("users.RedeemLoginLink", "Email address has changed since the link was sent")
+		}
+	} else {
+		// another link for the address may have been redeemed in the meantime
+		taken, err := d.Taken("", email, "")
+		if err != nil {
+			return errors.InternalServerError("users.RedeemLoginLink", err.Error())
+		}
+		if taken {
+			return errors.BadRequest("users.RedeemLoginLink", "Account already exists, request a new link")
+		}
+		usr, err = s.createPasswordless(d, "", email, true)
+		if err != nil {
+			return errors.InternalServerError("users.RedeemLoginLink", err.Error())
+		}
+		rsp.Created = true
+	}
+	ev.UserID = usr.Id
+	if usr.Deleted > 0 {
+		return errors.Forbidden("users.RedeemLoginLink", "Account has been deleted")
+	}
+
+	// following the link proves they own the address
+	if err := s.claimAccount(d, usr); err != nil {
+		return errors.InternalServerError("users.RedeemLoginLink", err.Error())
+	}
+	sess, challenge, err := s.startSession(ctx, d, usr)
+	if err != nil {
+		return errors.InternalServerError("users.RedeemLoginLink", err.Error())
+	}
+	if rsp.Token, err = s.token(d, sess); err != nil {
+		return errors.InternalServerError("users.RedeemLoginLink", err.Error())
+	}
+	rsp.Session = sess
+	rsp.Challenge = challenge
+	return nil
+}
@@ -0,0 +1,158 @@
+package handler
+
+import (
+	"strings"
+	"time"
+
+	"github.com/embedscript/backend/users/domain"
+	"github.com/embedscript/backend/users/oauth"
+	pb "github.com/embedscript/backend/users/proto"
+	"github.com/micro/micro/v3/service/errors"
+	"github.com/micro/micro/v3/service/logger"
+	"golang.org/x/net/context"
+)
+
+const (
+	// how long the user has to sign in at the provider
+	oauthStateExpiry = 10 * time.Minute
+)
+
+func (s *Users) OAuthURL(ctx context.Context, req *pb.OAuthURLRequest, rsp *pb.OAuthURLResponse) error {
+	d, err := s.domain(req.Tenant)
+	if err != nil {
+		return err
+	}
+	if len(req.RedirectUrl) == 0 {
+		return errors.BadRequest("users.OAuthURL", "Missing redirect url")
+	}
+	prov, err := s.providers.Get(req.Provider, req.RedirectUrl)
+	if err != nil {
+		return errors.BadRequest("users.OAuthURL", err.Error())
+	}
+
+	state := random(32)
+	verifier := random(64)
+	u, err := prov.AuthCodeURL(ctx, state, verifier, req.RedirectUrl)
+	if err != nil {
+		return errors.InternalServerError("users.OAuthURL", err.Error())
+	}
+	if err := d.CreateOAuthState(state, &domain.OAuthState{
+		Provider:    req.Provider,
+		RedirectURL: req.RedirectUrl,
+		Verifier:    verifier,
+		Expires:     time.Now().Add(oauthStateExpiry).Unix(),
+	}); err != nil {
+		return errors.InternalServerError("users.OAuthURL", err.Error())
+	}
+	rsp.Url = u
+	return nil
+}
+
+func (s *Users) OAuthLogin(ctx context.Context, req *pb.OAuthLoginRequest, rsp *pb.OAuthLoginResponse) (err error) {
+	d, err := s.domain(req.Tenant)
+	if err != nil {
+		return err
+	}
+	ev := newAuditEvent(ctx, domain.AuditLogin, methodOAuth+":"+req.Provider)
+	defer func() { s.auditLogin(d, ev, rsp.Session, rsp.Challenge, err) }()
+
+	if len(req.Code) == 0 || len(req.State) == 0 {
+		return errors.BadRequest("users.OAuthLogin", "Missing code or state")
+	}
+	state, err := d.RedeemOAuthState(req.State)
+	if err != nil {
+		return errors.BadRequest("users.OAuthLogin", err.Error())
+	}
+	if state.Provider != req.Provider {
+		return errors.BadRequest("users.OAuthLogin", "State was issued for another provider")
+	}
+	prov, err := s.providers.Get(state.Provider, state.RedirectURL)
+	if err != nil {
+		return errors.BadRequest("users.OAuthLogin", err.Error())
+	}
+	id, err := prov.Exchange(ctx, req.Code, state.Verifier, state.RedirectURL)
+	if err != nil {
+		logger.Errorf("Error exchanging %v code: %v", req.Provider, err)
+		return errors.Unauthorized("users.OAuthLogin", "Failed to sign in with %v", req.Provider)
+	}
+
+	usr, created, err := s.userForIdentity(d, id)
+	if err != nil {
+		return err
+	}
+	ev.UserID = usr.Id
+	sess, challenge, err := s.startSession(ctx, d, usr)
+	if err != nil {
+		return errors.InternalServerError("users.OAuthLogin", err.Error())
+	}
+	if rsp.Token, err = s.token(d, sess); err != nil {
+		return errors.InternalServerError("users.OAuthLogin", err.Error())
+	}
+	rsp.Session = sess
+	rsp.Challenge = challenge
+	rsp.Created = created
+	return nil
+}
+
+// userForIdentity returns the user an identity is linked to. Unlinked
+// identities are linked to the user with the same email if the provider
+// verified it, otherwise a new user is created. If that user never verified
+// the email the account is claimed first, see claimAccount.
+func (s *Users) userForIdentity(d *domain.Domain, id *oauth.Identity) (*pb.User, bool, error) {
+	linked, err := d.ReadIdentity(id.Provider, id.Subject)
+	if err != nil {
+		return nil, false, errors.InternalServerError("users.OAuthLogin", err.Error())
+	}
+	if linked != nil {
+		usr, err := d.Read(linked.UserID)
+		if err != nil {
+			return nil, false, errors.InternalServerError("users.OAuthLogin", err.Error())
+		}
+		if usr.Deleted > 0 {
+			return nil, false, errors.Forbidden("users.OAuthLogin", "Account has been deleted")
+		}
+		return usr, false, nil
+	}
+
+	email := strings.ToLower(id.Email)
+	if len(email) > 0 {
+		if usr, err := d.Lookup("", email); err == nil {
+			if usr.Deleted > 0 {
+				return nil, false, errors.Forbidden("users.OAuthLogin", "Account has been deleted")
+			}
+			if !id.EmailVerified {
+				return nil, false, errors.Conflict("users.OAuthLogin", "An account with this email already exists, sign in with your password")
+			}
+			if err := s.claimAccount(d, usr); err != nil {
+				return nil, false, errors.InternalServerError("users.OAuthLogin", err.Error())
+			}
+			if err := d.LinkIdentity(id.Provider, id.Subject, usr.Id, email); err != nil {
+				return nil, false, errors.InternalServerError("users.OAuthLogin", err.Error())
+			}
+			return usr, false, nil
+		}
+	}
+
+	if s.inviteOnly(d.Tenant()) {
+		return nil, false, errors.Forbidden("users.OAuthLogin", "Signing up needs an invite, sign up with your invite code first")
+	}
+	usr, err := s.createPasswordless(d, id.Username, email, id.EmailVerified)
+	if err != nil {
+		return nil, false, errors.InternalServerError("users.OAuthLogin", err.Error())
+	}
+	if err := d.LinkIdentity(id.Provider, id.Subject, usr.Id, email); err != nil {
+		return nil, false, errors.InternalServerError("users.OAuthLogin", err.Error())
+	}
+	return usr, true, nil
+}
+
+// purgeOAuthStates deletes the state of sign ins that were never completed
+func (s *Users) purgeOAuthStates(d *domain.Domain) {
+	n, err := d.DeleteExpiredOAuthStates(time.Now())
+	if err != nil {
+		logger.Errorf("Error purging oauth states of tenant %q: %v", d.Tenant(), err)
+	}
+	if n > 0 {
+		logger.Infof("Purged %v expired oauth states of tenant %q", n, d.Tenant())
+	}
+}
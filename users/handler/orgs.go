@@ -0,0 +1,508 @@
+package handler
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/embedscript/backend/users/domain"
+	pb "github.com/embedscript/backend/users/proto"
+	"github.com/google/uuid"
+	"github.com/micro/micro/v3/service/errors"
+	"golang.org/x/net/context"
+)
+
+const (
+	fieldOrgName = "name"
+
+	orgInviteExpiry = 7 * 24 * time.Hour
+)
+
+// orgInvite is the data of an emailed org invitation token
+type orgInvite struct {
+	OrgID string `json:"orgId"`
+	Role  string `json:"role"`
+	Email string `json:"email"`
+}
+
+func fromOrg(org *domain.Org) *pb.Org {
+	return &pb.Org{
+		Id:          org.ID,
+		Name:        org.Name,
+		DisplayName: org.DisplayName,
+		Created:     org.Created,
+		Updated:     org.Updated,
+	}
+}
+
+func fromMembership(m *domain.Membership) *pb.Membership {
+	return &pb.Membership{
+		OrgId:   m.OrgID,
+		UserId:  m.UserID,
+		Role:    m.Role,
+		Created: m.Created,
+	}
+}
+
+// orgMember reads the session a request was made with and the caller's
+// membership of an org, which needs at least the given role. Impersonated
+// sessions can only do what any member can, an admin impersonating an org
+// owner can't delete the org or manage its members.
+func orgMember(d *domain.Domain, id, sessionID, orgID, min string) (*pb.Session, *domain.Membership, error) {
+	if len(sessionID) == 0 {
+		return nil, nil, errors.Unauthorized(id, "Missing session id")
+	}
+	if len(orgID) == 0 {
+		return nil, nil, errors.BadRequest(id, "Missing org id")
+	}
+	sess, err := d.ReadSession(sessionID)
+	if err != nil {
+		return nil, nil, errors.Unauthorized(id, "Invalid session")
+	}
+	org, err := d.ReadOrg(orgID)
+	if err != nil {
+		return nil, nil, errors.InternalServerError(id, err.Error())
+	}
+	if org == nil {
+		return nil, nil, errors.NotFound(id, "Org not found")
+	}
+	m, err := d.ReadMembership(orgID, sess.UserId)
+	if err != nil {
+		return nil, nil, errors.InternalServerError(id, err.Error())
+	}
+	if m == nil || !domain.OrgRoleAtLeast(m.Role, min) {
+		return nil, nil, errors.Forbidden(id, "Not allowed to do this in the org")
+	}
+	if min != domain.OrgMember && impersonated(sess) {
+		return nil, nil, errors.Forbidden(id, "Impersonated sessions can't manage the org")
+	}
+	return sess, m, nil
+}
+
+// checkOrgName validates a new org name, which can't be taken by a user or
+// another org
+func (s *Users) checkOrgName(d *domain.Domain, name string) error {
+	var errs fieldErrors
+	s.policy(d.Tenant()).name(&errs, fieldOrgName, name)
+	if len(errs) > 0 {
+		return errs
+	}
+	taken, err := d.Taken(name, "", "")
+	if err != nil {
+		return err
+	}
+	if taken {
+		errs.add(fieldOrgName, codeNotAllowed, "%v %q is already in use", fieldOrgName, name)
+		return errs
+	}
+	return nil
+}
+
+// orgNameError surfaces the result of checkOrgName
+func orgNameError(id string, err error) error {
+	if errs, ok := err.(fieldErrors); ok {
+		return errs.err(id)
+	}
+	return errors.InternalServerError(id, err.Error())
+}
+
+func (s *Users) CreateOrg(ctx context.Context, req *pb.CreateOrgRequest, rsp *pb.CreateOrgResponse) error {
+	d, err := s.domain(req.Tenant)
+	if err != nil {
+		return err
+	}
+	if len(req.SessionId) == 0 {
+		return errors.Unauthorized("users.CreateOrg", "Missing session id")
+	}
+	sess, err := d.ReadSession(req.SessionId)
+	if err != nil {
+		return errors.Unauthorized("users.CreateOrg", "Invalid session")
+	}
+	name := strings.ToLower(strings.TrimSpace(req.Name))
+	if err := s.checkOrgName(d, name); err != nil {
+		return orgNameError("users.CreateOrg", err)
+	}
+
+	now := s.now().Unix()
+	org := &domain.Org{
+		ID:          uuid.New().String(),
+		Name:        name,
+		DisplayName: req.DisplayName,
+		Created:     now,
+		Updated:     now,
+	}
+	if err := d.SaveOrg(org); err != nil {
+		return errors.InternalServerError("users.CreateOrg", err.Error())
+	}
+	owner := domain.NewMembership(org.ID, sess.UserId, domain.OrgOwner)
+	owner.Created = now
+	if err := d.SaveMembership(owner); err != nil {
+		return errors.InternalServerError("users.CreateOrg", err.Error())
+	}
+	rsp.Org = fromOrg(org)
+	return nil
+}
+
+func (s *Users) ReadOrg(ctx context.Context, req *pb.ReadOrgRequest, rsp *pb.ReadOrgResponse) error {
+	d, err := s.domain(req.Tenant)
+	if err != nil {
+		return err
+	}
+	var org *domain.Org
+	switch {
+	case len(req.Id) > 0:
+		org, err = d.ReadOrg(req.Id)
+	case len(req.Name) > 0:
+		org, err = d.ReadOrgByName(req.Name)
+	default:
+		return errors.BadRequest("users.ReadOrg", "Missing org id or name")
+	}
+	if err != nil {
+		return errors.InternalServerError("users.ReadOrg", err.Error())
+	}
+	if org == nil {
+		return errors.NotFound("users.ReadOrg", "Org not found")
+	}
+	rsp.Org = fromOrg(org)
+	return nil
+}
+
+// UpdateOrg renames an org or changes its display name
+func (s *Users) UpdateOrg(ctx context.Context, req *pb.UpdateOrgRequest, rsp *pb.UpdateOrgResponse) error {
+	d, err := s.domain(req.Tenant)
+	if err != nil {
+		return err
+	}
+	if req.Org == nil {
+		return errors.BadRequest("users.UpdateOrg", "Missing org")
+	}
+	if _, _, err := orgMember(d, "users.UpdateOrg", req.SessionId, req.Org.Id, domain.OrgAdmin); err != nil {
+		return err
+	}
+	org, err := d.ReadOrg(req.Org.Id)
+	if err != nil {
+		return errors.InternalServerError("users.UpdateOrg", err.Error())
+	}
+	if name := strings.ToLower(strings.TrimSpace(req.Org.Name)); len(name) > 0 && name != org.Name {
+		if err := s.checkOrgName(d, name); err != nil {
+			return orgNameError("users.UpdateOrg", err)
+		}
+		org.Name = name
+	}
+	org.DisplayName = req.Org.DisplayName
+	org.Updated = s.now().Unix()
+	if err := d.SaveOrg(org); err != nil {
+		return errors.InternalServerError("users.UpdateOrg", err.Error())
+	}
+	rsp.Org = fromOrg(org)
+	return nil
+}
+
+// DeleteOrg deletes an org and its memberships, sessions it's active on
+// switch back to the user's own account
+func (s *Users) DeleteOrg(ctx context.Context, req *pb.DeleteOrgRequest, rsp *pb.DeleteOrgResponse) error {
+	d, err := s.domain(req.Tenant)
+	if err != nil {
+		return err
+	}
+	if _, _, err := orgMember(d, "users.DeleteOrg", req.SessionId, req.Id, domain.OrgOwner); err != nil {
+		return err
+	}
+	if err := d.DeleteOrg(req.Id); err != nil {
+		return errors.InternalServerError("users.DeleteOrg", err.Error())
+	}
+	return nil
+}
+
+// InviteMember emails a token that adds whoever redeems it with AcceptMemberInvite
+// to the org, as long as they're signed in with the invited address
+func (s *Users) InviteMember(ctx context.Context, req *pb.InviteMemberRequest, rsp *pb.InviteMemberResponse) error {
+	d, err := s.domain(req.Tenant)
+	if err != nil {
+		return err
+	}
+	sess, m, err := orgMember(d, "users.InviteMember", req.SessionId, req.OrgId, domain.OrgAdmin)
+	if err != nil {
+		return err
+	}
+	email := strings.ToLower(strings.TrimSpace(req.Email))
+	if len(email) == 0 {
+		return errors.BadRequest("users.InviteMember", "Missing email")
+	}
+	role := req.Role
+	if len(role) == 0 {
+		role = domain.OrgMember
+	}
+	if !domain.ValidOrgRole(role) {
+		return errors.BadRequest("users.InviteMember", domain.ErrInvalidOrgRole.Error())
+	}
+	if !domain.OrgRoleAtLeast(m.Role, role) {
+		return errors.Forbidden("users.InviteMember", "Only owners can invite owners")
+	}
+	org, err := d.ReadOrg(req.OrgId)
+	if err != nil {
+		return errors.InternalServerError("users.InviteMember", err.Error())
+	}
+
+	data, err := json.Marshal(orgInvite{OrgID: org.ID, Role: role, Email: email})
+	if err != nil {
+		return errors.InternalServerError("users.InviteMember", err.Error())
+	}
+	tok := random(32)
+	if err := d.CreateTokenWithData(domain.TokenOrgInvite, tok, sess.UserId, string(data), time.Now().Add(orgInviteExpiry)); err != nil {
+		return errors.InternalServerError("users.InviteMember", err.Error())
+	}
+	if err := s.sendEmail(ctx, email, s.config.Sendgrid.OrgInviteTemplateID, map[string]interface{}{
+		"org":         org.Name,
+		"displayName": org.DisplayName,
+		"invitedBy":   sess.Username,
+		"role":        role,
+		"token":       tok,
+		"tenant":      d.Tenant(),
+	}); err != nil {
+		return errors.InternalServerError("users.InviteMember", err.Error())
+	}
+	return nil
+}
+
+// AcceptMemberInvite redeems an org invitation. Users who already are
+// members keep the higher of their role and the invited one.
+func (s *Users) AcceptMemberInvite(ctx context.Context, req *pb.AcceptMemberInviteRequest, rsp *pb.AcceptMemberInviteResponse) error {
+	d, err := s.domain(req.Tenant)
+	if err != nil {
+		return err
+	}
+	if len(req.SessionId) == 0 {
+		return errors.Unauthorized("users.AcceptMemberInvite", "Missing session id")
+	}
+	if len(req.Token) == 0 {
+		return errors.BadRequest("users.AcceptMemberInvite", "Missing token")
+	}
+	sess, err := d.ReadSession(req.SessionId)
+	if err != nil {
+		return errors.Unauthorized("users.AcceptMemberInvite", "Invalid session")
+	}
+	usr, err := d.Read(sess.UserId)
+	if err != nil {
+		return errors.InternalServerError("users.AcceptMemberInvite", err.Error())
+	}
+	if !usr.Verified {
+		return errors.Forbidden("users.AcceptMemberInvite", "Email address isn't verified")
+	}
+
+	// the invitation is only used up once it's accepted by who it was sent
+	// to, anyone else who gets hold of the token can't burn it
+	_, data, err := d.ReadTokenWithData(domain.TokenOrgInvite, req.Token, s.now())
+	if err != nil {
+		return errors.BadRequest("users.AcceptMemberInvite", err.Error())
+	}
+	var inv orgInvite
+	if err := json.Unmarshal([]byte(data), &inv); err != nil {
+		return errors.InternalServerError("users.AcceptMemberInvite", err.Error())
+	}
+	if inv.Email != usr.Email {
+		return errors.Forbidden("users.AcceptMemberInvite", "Invitation was sent to another email address")
+	}
+	if _, _, err := d.RedeemTokenWithData(domain.TokenOrgInvite, req.Token); err != nil {
+		return errors.BadRequest("users.AcceptMemberInvite", err.Error())
+	}
+	org, err := d.ReadOrg(inv.OrgID)
+	if err != nil {
+		return errors.InternalServerError("users.AcceptMemberInvite", err.Error())
+	}
+	if org == nil {
+		return errors.NotFound("users.AcceptMemberInvite", "Org not found")
+	}
+
+	m, err := d.ReadMembership(org.ID, usr.Id)
+	if err != nil {
+		return errors.InternalServerError("users.AcceptMemberInvite", err.Error())
+	}
+	if m == nil {
+		m = domain.NewMembership(org.ID, usr.Id, inv.Role)
+		m.Created = s.now().Unix()
+	} else if domain.OrgRoleAtLeast(inv.Role, m.Role) {
+		m.Role = inv.Role
+	}
+	if err := d.SaveMembership(m); err != nil {
+		return errors.InternalServerError("users.AcceptMemberInvite", err.Error())
+	}
+	rsp.Membership = fromMembership(m)
+	return nil
+}
+
+func (s *Users) UpdateMember(ctx context.Context, req *pb.UpdateMemberRequest, rsp *pb.UpdateMemberResponse) error {
+	d, err := s.domain(req.Tenant)
+	if err != nil {
+		return err
+	}
+	_, caller, err := orgMember(d, "users.UpdateMember", req.SessionId, req.OrgId, domain.OrgAdmin)
+	if err != nil {
+		return err
+	}
+	if !domain.ValidOrgRole(req.Role) {
+		return errors.BadRequest("users.UpdateMember", domain.ErrInvalidOrgRole.Error())
+	}
+	m, err := d.ReadMembership(req.OrgId, req.UserId)
+	if err != nil {
+		return errors.InternalServerError("users.UpdateMember", err.Error())
+	}
+	if m == nil {
+		return errors.NotFound("users.UpdateMember", "Member not found")
+	}
+	if caller.Role != domain.OrgOwner && (m.Role == domain.OrgOwner || req.Role == domain.OrgOwner) {
+		return errors.Forbidden("users.UpdateMember", "Only owners can make or demote owners")
+	}
+	if m.Role == domain.OrgOwner && req.Role != domain.OrgOwner {
+		if err := lastOwner(d, "users.UpdateMember", req.OrgId); err != nil {
+			return err
+		}
+	}
+	m.Role = req.Role
+	if err := d.SaveMembership(m); err != nil {
+		return errors.InternalServerError("users.UpdateMember", err.Error())
+	}
+	rsp.Membership = fromMembership(m)
+	return nil
+}
+
+// RemoveMember removes a member from an org, members can remove themselves
+// to leave it
+func (s *Users) RemoveMember(ctx context.Context, req *pb.RemoveMemberRequest, rsp *pb.RemoveMemberResponse) error {
+	d, err := s.domain(req.Tenant)
+	if err != nil {
+		return err
+	}
+	if len(req.UserId) == 0 {
+		return errors.BadRequest("users.RemoveMember", "Missing user id")
+	}
+	sess, caller, err := orgMember(d, "users.RemoveMember", req.SessionId, req.OrgId, domain.OrgMember)
+	if err != nil {
+		return err
+	}
+	m := caller
+	if req.UserId != sess.UserId {
+		if !domain.OrgRoleAtLeast(caller.Role, domain.OrgAdmin) {
+			return errors.Forbidden("users.RemoveMember", "Not allowed to do this in the org")
+		}
+		if impersonated(sess) {
+			return errors.Forbidden("users.RemoveMember", "Impersonated sessions can't manage the org")
+		}
+		if m, err = d.ReadMembership(req.OrgId, req.UserId); err != nil {
+			return errors.InternalServerError("users.RemoveMember", err.Error())
+		}
+		if m == nil {
+			return errors.NotFound("users.RemoveMember", "Member not found")
+		}
+		if m.Role == domain.OrgOwner && caller.Role != domain.OrgOwner {
+			return errors.Forbidden("users.RemoveMember", "Only owners can remove owners")
+		}
+	}
+	if m.Role == domain.OrgOwner {
+		if err := lastOwner(d, "users.RemoveMember", req.OrgId); err != nil {
+			return err
+		}
+	}
+	if err := d.DeleteMembership(req.OrgId, req.UserId); err != nil {
+		return errors.InternalServerError("users.RemoveMember", err.Error())
+	}
+	return nil
+}
+
+// lastOwner returns an error if an org has only one owner left, who can't
+// leave or be demoted
+func lastOwner(d *domain.Domain, id, orgID string) error {
+	n, err := d.CountOwners(orgID)
+	if err != nil {
+		return errors.InternalServerError(id, err.Error())
+	}
+	if n <= 1 {
+		return errors.BadRequest(id, domain.ErrLastOwner.Error())
+	}
+	return nil
+}
+
+func (s *Users) ListMembers(ctx context.Context, req *pb.ListMembersRequest, rsp *pb.ListMembersResponse) error {
+	d, err := s.domain(req.Tenant)
+	if err != nil {
+		return err
+	}
+	if _, _, err := orgMember(d, "users.ListMembers", req.SessionId, req.OrgId, domain.OrgMember); err != nil {
+		return err
+	}
+	limit, offset := pageOf(req.Limit, req.Offset)
+	members, err := d.ListMembers(req.OrgId, limit, offset)
+	if err != nil {
+		return errors.InternalServerError("users.ListMembers", err.Error())
+	}
+	for _, m := range members {
+		rsp.Members = append(rsp.Members, fromMembership(m))
+	}
+	return nil
+}
+
+func (s *Users) ListMemberships(ctx context.Context, req *pb.ListMembershipsRequest, rsp *pb.ListMembershipsResponse) error {
+	d, err := s.domain(req.Tenant)
+	if err != nil {
+		return err
+	}
+	if len(req.UserId) == 0 {
+		return errors.BadRequest("users.ListMemberships", "Missing user id")
+	}
+	if _, err := callerSession(d, "users.ListMemberships", req.SessionId, req.UserId); err != nil {
+		return err
+	}
+	memberships, err := d.ListMemberships(req.UserId)
+	if err != nil {
+		return errors.InternalServerError("users.ListMemberships", err.Error())
+	}
+	for _, m := range memberships {
+		org, err := d.ReadOrg(m.OrgID)
+		if err != nil {
+			return errors.InternalServerError("users.ListMemberships", err.Error())
+		}
+		// skip memberships of an org that's being deleted
+		if org == nil {
+			continue
+		}
+		pm := fromMembership(m)
+		pm.Org = fromOrg(org)
+		rsp.Memberships = append(rsp.Memberships, pm)
+	}
+	return nil
+}
+
+// SwitchOrg makes an org the active one of a session, so what the user
+// creates is owned by the org. A new access token is issued with the org in
+// its claims.
+func (s *Users) SwitchOrg(ctx context.Context, req *pb.SwitchOrgRequest, rsp *pb.SwitchOrgResponse) error {
+	d, err := s.domain(req.Tenant)
+	if err != nil {
+		return err
+	}
+	var sess *pb.Session
+	if len(req.OrgId) > 0 {
+		if sess, _, err = orgMember(d, "users.SwitchOrg", req.SessionId, req.OrgId, domain.OrgMember); err != nil {
+			return err
+		}
+	} else {
+		if len(req.SessionId) == 0 {
+			return errors.Unauthorized("users.SwitchOrg", "Missing session id")
+		}
+		if sess, err = d.ReadSession(req.SessionId); err != nil {
+			return errors.Unauthorized("users.SwitchOrg", "Invalid session")
+		}
+	}
+	sess.OrgId = req.OrgId
+	if err := withRoles(d, sess); err != nil {
+		return errors.InternalServerError("users.SwitchOrg", err.Error())
+	}
+	if err := d.UpdateSession(sess); err != nil {
+		return errors.InternalServerError("users.SwitchOrg", err.Error())
+	}
+	if rsp.Token, err = s.token(d, sess); err != nil {
+		return errors.InternalServerError("users.SwitchOrg", err.Error())
+	}
+	rsp.Session = sess
+	return nil
+}
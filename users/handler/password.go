@@ -0,0 +1,293 @@
+package handler
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/micro/micro/v3/service/logger"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// legacyPepper was used before peppers moved to config. It's only kept to
+	// verify passwords hashed before then, which are rehashed on login.
+	legacyPepper = "cruft123"
+
+	algorithmBcrypt   = "bcrypt"
+	algorithmArgon2id = "argon2id"
+
+	// versionImported marks hashes imported from another system, which were
+	// made without a pepper or salt. They're rehashed on the next login.
+	versionImported = -1
+
+	// prehashPrefix marks bcrypt hashes of an HMAC of the password rather
+	// than of the password itself
+	prehashPrefix = "$hmac-sha256"
+
+	// limits on the parameters of imported hashes, every login runs with
+	// them so a file could otherwise make logins arbitrarily slow, or make
+	// argon2 panic with parameters it doesn't accept
+	maxImportBcryptCost      = 14
+	maxImportArgon2Memory    = 256 * 1024
+	maxImportArgon2Time      = 10
+	maxImportArgon2Threads   = 16
+	minImportArgon2KeyLength = 16
+	maxImportArgon2KeyLength = 64
+	// argon2 needs at least 8 KiB of memory per thread
+	minImportArgon2MemoryPerThread = 8
+)
+
+var (
+	errMismatchedPassword = errors.New("password does not match")
+	errInvalidHash        = errors.New("invalid password hash")
+)
+
+type argon2Conf struct {
+	// number of passes over the memory
+	Time uint32 `json:"time"`
+	// memory in KiB
+	Memory    uint32 `json:"memory"`
+	Threads   uint8  `json:"threads"`
+	KeyLength uint32 `json:"key_length"`
+}
+
+type passwordConf struct {
+	// peppers by version, old versions are kept so existing hashes verify
+	Peppers map[string]string `json:"peppers"`
+	// the pepper version used for new hashes
+	Version int `json:"version"`
+	// algorithm for new hashes, bcrypt or argon2id
+	Algorithm string `json:"algorithm"`
+	// bcrypt cost for new hashes
+	Cost   int        `json:"cost"`
+	Argon2 argon2Conf `json:"argon2"`
+}
+
+// hasher hashes and verifies peppered, salted passwords. Hashes are stored
+// along with the version of the pepper used to create them. Both bcrypt and
+// argon2id hashes verify regardless of the algorithm used for new hashes.
+type hasher struct {
+	peppers   map[int]string
+	version   int
+	algorithm string
+	cost      int
+	argon2    argon2Conf
+}
+
+func newHasher(c passwordConf) *hasher {
+	h := &hasher{
+		peppers:   map[int]string{0: legacyPepper, versionImported: ""},
+		version:   c.Version,
+		algorithm: c.Algorithm,
+		cost:      c.Cost,
+		argon2:    c.Argon2,
+	}
+	for k, v := range c.Peppers {
+		version, err := strconv.Atoi(k)
+		if err != nil || version <= 0 {
+			logger.Fatalf("Invalid pepper version %q", k)
+		}
+		h.peppers[version] = v
+	}
+	if _, ok := h.peppers[h.version]; !ok || h.version < 0 {
+		logger.Fatalf("No pepper configured for version %v", h.version)
+	}
+	if h.version == 0 {
+		logger.Warnf("No password pepper configured, using the legacy pepper")
+	}
+
+	switch h.algorithm {
+	case "":
+		h.algorithm = algorithmBcrypt
+	case algorithmBcrypt, algorithmArgon2id:
+	default:
+		logger.Fatalf("Unknown password algorithm %q", h.algorithm)
+	}
+
+	if h.cost == 0 {
+		h.cost = bcrypt.DefaultCost
+	}
+	if h.cost < bcrypt.MinCost || h.cost > bcrypt.MaxCost {
+		logger.Fatalf("Invalid bcrypt cost %v", h.cost)
+	}
+
+	// defaults as recommended by RFC 9106
+	if h.argon2.Time == 0 {
+		h.argon2.Time = 1
+	}
+	if h.argon2.Memory == 0 {
+		h.argon2.Memory = 64 * 1024
+	}
+	if h.argon2.Threads == 0 {
+		h.argon2.Threads = 4
+	}
+	if h.argon2.KeyLength == 0 {
+		h.argon2.KeyLength = 32
+	}
+	return h
+}
+
+// hash returns a new random salt, the encoded hash of the password and the
+// pepper version used
+func (h *hasher) hash(password string) (string, string, int, error) {
+	salt := random(16)
+	pepper := h.peppers[h.version]
+
+	var b []byte
+	var err error
+	switch h.algorithm {
+	case algorithmArgon2id:
+		b, err = h.hashArgon2([]byte(pepper + salt + password))
+	default:
+		b, err = bcrypt.GenerateFromPassword(prehash(pepper, salt, password), h.cost)
+		b = append([]byte(prehashPrefix), b...)
+	}
+	if err != nil {
+		return "", "", 0, err
+	}
+	return salt, base64.StdEncoding.EncodeToString(b), h.version, nil
+}
+
+// prehash returns what's hashed with bcrypt: an HMAC of the salted password
+// keyed with the pepper. bcrypt ignores input past 72 bytes, so hashing the
+// pepper, salt and password directly would leave long passwords mostly
+// unchecked.
+func prehash(pepper, salt, password string) []byte {
+	mac := hmac.New(sha256.New, []byte(pepper))
+	mac.Write([]byte(salt + password))
+	return []byte(base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+}
+
+// importHash checks a bcrypt or argon2id hash of a password made by another
+// system and returns it the way hash does, so it verifies as it is
+func importHash(hashed string) (string, string, int, error) {
+	b := []byte(hashed)
+	if isArgon2(b) {
+		p, _, _, err := decodeArgon2(b)
+		if err != nil {
+			return "", "", 0, errInvalidHash
+		}
+		if p.Time < 1 || p.Time > maxImportArgon2Time ||
+			p.Threads < 1 || p.Threads > maxImportArgon2Threads ||
+			p.Memory < minImportArgon2MemoryPerThread*uint32(p.Threads) || p.Memory > maxImportArgon2Memory ||
+			p.KeyLength < minImportArgon2KeyLength || p.KeyLength > maxImportArgon2KeyLength {
+			return "", "", 0, errInvalidHash
+		}
+	} else if cost, err := bcrypt.Cost(b); err != nil || cost > maxImportBcryptCost {
+		return "", "", 0, errInvalidHash
+	}
+	return "", base64.StdEncoding.EncodeToString(b), versionImported, nil
+}
+
+// verify checks a password against a stored hash
+func (h *hasher) verify(password, salt, hashed string, version int) error {
+	pepper, ok := h.peppers[version]
+	if !ok {
+		return fmt.Errorf("no pepper configured for version %v", version)
+	}
+	b, err := base64.StdEncoding.DecodeString(hashed)
+	if err != nil {
+		return err
+	}
+	if isArgon2(b) {
+		return verifyArgon2(b, []byte(pepper+salt+password))
+	}
+	if bytes.HasPrefix(b, []byte(prehashPrefix)) {
+		return bcrypt.CompareHashAndPassword(b[len(prehashPrefix):], prehash(pepper, salt, password))
+	}
+	// imported hashes and ones made before prehashing
+	return bcrypt.CompareHashAndPassword(b, []byte(pepper+salt+password))
+}
+
+// needsRehash reports whether a stored hash was created with an old pepper,
+// another algorithm or different parameters than the current ones, or is a
+// bcrypt hash without prehashing
+func (h *hasher) needsRehash(hashed string, version int) bool {
+	if version != h.version {
+		return true
+	}
+	b, err := base64.StdEncoding.DecodeString(hashed)
+	if err != nil {
+		return true
+	}
+	if isArgon2(b) {
+		if h.algorithm != algorithmArgon2id {
+			return true
+		}
+		p, _, _, err := decodeArgon2(b)
+		return err != nil || p != h.argon2
+	}
+	if h.algorithm != algorithmBcrypt || !bytes.HasPrefix(b, []byte(prehashPrefix)) {
+		return true
+	}
+	cost, err := bcrypt.Cost(b[len(prehashPrefix):])
+	return err != nil || cost != h.cost
+}
+
+// hashArgon2 hashes the input with a random salt and encodes the result in
+// the PHC string format, eg. $argon2id$v=19$m=65536,t=1,p=4$<salt>$<key>
+func (h *hasher) hashArgon2(input []byte) ([]byte, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	p := h.argon2
+	key := argon2.IDKey(input, salt, p.Time, p.Memory, p.Threads, p.KeyLength)
+	return []byte(fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, p.Memory, p.Time, p.Threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	)), nil
+}
+
+func isArgon2(hashed []byte) bool {
+	return strings.HasPrefix(string(hashed), "$"+algorithmArgon2id+"$")
+}
+
+// decodeArgon2 parses a PHC formatted argon2id hash into its parameters,
+// salt and key
+func decodeArgon2(hashed []byte) (argon2Conf, []byte, []byte, error) {
+	var p argon2Conf
+	parts := strings.Split(string(hashed), "$")
+	if len(parts) != 6 || parts[1] != algorithmArgon2id {
+		return p, nil, nil, errInvalidHash
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return p, nil, nil, errInvalidHash
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.Memory, &p.Time, &p.Threads); err != nil {
+		return p, nil, nil, errInvalidHash
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return p, nil, nil, errInvalidHash
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return p, nil, nil, errInvalidHash
+	}
+	p.KeyLength = uint32(len(key))
+	return p, salt, key, nil
+}
+
+func verifyArgon2(hashed, input []byte) error {
+	p, salt, key, err := decodeArgon2(hashed)
+	if err != nil {
+		return err
+	}
+	other := argon2.IDKey(input, salt, p.Time, p.Memory, p.Threads, p.KeyLength)
+	if subtle.ConstantTimeCompare(key, other) != 1 {
+		return errMismatchedPassword
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package handler
+
+import (
+	"encoding/base64"
+	"fmt"
+	"testing"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// argon2Hash returns a PHC formatted argon2id hash of the password with the
+// given parameters
+func argon2Hash(password string, m, t uint32, p uint8, keyLength uint32) string {
+	salt := []byte("saltsaltsaltsalt")
+	key := argon2.IDKey([]byte(password), salt, t, m, p, keyLength)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, m, t, p,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key))
+}
+
+// argon2Params returns a hash with the given parameters that doesn't need
+// computing, for parameters that are rejected before it would be checked
+func argon2Params(m, t, p string) string {
+	return "$argon2id$v=19$m=" + m + ",t=" + t + ",p=" + p + "$c2FsdHNhbHQ$aGFzaGhhc2hoYXNoaGFzaA"
+}
+
+func TestImportHash(t *testing.T) {
+	tests := []struct {
+		name   string
+		hashed string
+		ok     bool
+	}{
+		{name: "bcrypt", hashed: "$2a$10$N9qo8uLOickgx2ZMRZoMyeIjZAgcfl7p92ldGxad68LJZdL17lhWy", ok: true},
+		{name: "bcrypt max cost", hashed: "$2a$14$N9qo8uLOickgx2ZMRZoMyeIjZAgcfl7p92ldGxad68LJZdL17lhWy", ok: true},
+		{name: "bcrypt cost too high", hashed: "$2a$15$N9qo8uLOickgx2ZMRZoMyeIjZAgcfl7p92ldGxad68LJZdL17lhWy"},
+		{name: "bcrypt cost 31", hashed: "$2a$31$N9qo8uLOickgx2ZMRZoMyeIjZAgcfl7p92ldGxad68LJZdL17lhWy"},
+		{name: "argon2id", hashed: argon2Params("65536", "3", "4"), ok: true},
+		{name: "argon2id minimums", hashed: argon2Params("8", "1", "1"), ok: true},
+		{name: "argon2id no passes", hashed: argon2Params("1024", "0", "1")},
+		{name: "argon2id no threads", hashed: argon2Params("1024", "1", "0")},
+		{name: "argon2id too little memory", hashed: argon2Params("31", "1", "4")},
+		{name: "argon2id too much memory", hashed: argon2Params("4194304", "1", "4")},
+		{name: "argon2id too many passes", hashed: argon2Params("65536", "1000", "4")},
+		{name: "argon2id too many threads", hashed: argon2Params("65536", "1", "200")},
+		{name: "argon2id short key", hashed: "$argon2id$v=19$m=65536,t=3,p=4$c2FsdHNhbHQ$aGFz"},
+		{name: "not a hash", hashed: "password1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, version, err := importHash(tt.hashed)
+			if (err == nil) != tt.ok {
+				t.Fatalf("importHash() error = %v, want ok %v", err, tt.ok)
+			}
+			if tt.ok && version != versionImported {
+				t.Errorf("importHash() version = %v, want %v", version, versionImported)
+			}
+		})
+	}
+}
+
+func TestImportedHashVerifies(t *testing.T) {
+	h := newHasher(passwordConf{})
+	for _, hashed := range []string{
+		argon2Hash("password1", 8, 1, 1, 16),
+		argon2Hash("password1", 64*1024, 1, 4, 32),
+	} {
+		salt, pp, version, err := importHash(hashed)
+		if err != nil {
+			t.Fatalf("importHash(%v) error = %v", hashed, err)
+		}
+		if err := h.verify("password1", salt, pp, version); err != nil {
+			t.Errorf("verify(%v) error = %v", hashed, err)
+		}
+		if err := h.verify("password2", salt, pp, version); err == nil {
+			t.Errorf("verify(%v) accepted the wrong password", hashed)
+		}
+	}
+}
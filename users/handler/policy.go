@@ -0,0 +1,258 @@
+package handler
+
+import (
+	"bufio"
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/micro/micro/v3/service/logger"
+)
+
+const (
+	fieldPassword        = "password"
+	fieldNewPassword     = "newPassword"
+	fieldConfirmPassword = "confirmPassword"
+
+	defaultUsernameMinLength = 3
+	defaultUsernameMaxLength = 32
+	defaultPasswordMinLength = 8
+	defaultPasswordMaxLength = 128
+
+	classLower  = "lower"
+	classUpper  = "upper"
+	classDigit  = "digit"
+	classSymbol = "symbol"
+)
+
+var (
+	// names that could be mistaken for the service or its staff
+	defaultReservedUsernames = []string{
+		"admin", "administrator", "api", "help", "me", "root", "security",
+		"staff", "support", "system", "user", "users", "www",
+	}
+
+	// some of the most common passwords that meet the default length
+	defaultPasswordBlocklist = []string{
+		"password", "password1", "password123", "12345678", "123456789",
+		"1234567890", "11111111", "00000000", "qwertyuiop", "qwerty123",
+		"iloveyou", "sunshine", "princess", "football", "baseball",
+		"welcome1", "letmein1", "abc12345", "passw0rd", "trustno1",
+	}
+)
+
+type usernamePolicyConf struct {
+	MinLength int `json:"min_length"`
+	MaxLength int `json:"max_length"`
+	// characters allowed besides lowercase letters and numbers, eg. "._-"
+	Characters *string `json:"characters"`
+	// usernames nobody can take, replaces the default list
+	Reserved []string `json:"reserved"`
+}
+
+type passwordPolicyConf struct {
+	MinLength int `json:"min_length"`
+	MaxLength int `json:"max_length"`
+	// character classes every password needs: lower, upper, digit or symbol
+	Require []string `json:"require"`
+	// passwords that are refused, compared case insensitively. They're
+	// checked along with the default list.
+	Blocklist []string `json:"blocklist"`
+	// file with a blocked password on every line
+	BlocklistFile string `json:"blocklist_file"`
+}
+
+type policyConf struct {
+	Username usernamePolicyConf `json:"username"`
+	Password passwordPolicyConf `json:"password"`
+}
+
+// merge returns the policy with the settings of another one that are set
+// replacing its own
+func (c policyConf) merge(o *policyConf) policyConf {
+	if o == nil {
+		return c
+	}
+	if o.Username.MinLength > 0 {
+		c.Username.MinLength = o.Username.MinLength
+	}
+	if o.Username.MaxLength > 0 {
+		c.Username.MaxLength = o.Username.MaxLength
+	}
+	if o.Username.Characters != nil {
+		c.Username.Characters = o.Username.Characters
+	}
+	if o.Username.Reserved != nil {
+		c.Username.Reserved = o.Username.Reserved
+	}
+	if o.Password.MinLength > 0 {
+		c.Password.MinLength = o.Password.MinLength
+	}
+	if o.Password.MaxLength > 0 {
+		c.Password.MaxLength = o.Password.MaxLength
+	}
+	if o.Password.Require != nil {
+		c.Password.Require = o.Password.Require
+	}
+	if o.Password.Blocklist != nil {
+		c.Password.Blocklist = o.Password.Blocklist
+	}
+	if len(o.Password.BlocklistFile) > 0 {
+		c.Password.BlocklistFile = o.Password.BlocklistFile
+	}
+	return c
+}
+
+// policy validates the usernames and passwords of new users and of users
+// changing them
+type policy struct {
+	usernameMin int
+	usernameMax int
+	characters  string
+	reserved    map[string]bool
+	passwordMin int
+	passwordMax int
+	require     []string
+	blocklist   map[string]bool
+}
+
+func newPolicy(c policyConf) *policy {
+	p := &policy{
+		usernameMin: c.Username.MinLength,
+		usernameMax: c.Username.MaxLength,
+		reserved:    map[string]bool{},
+		passwordMin: c.Password.MinLength,
+		passwordMax: c.Password.MaxLength,
+		blocklist:   map[string]bool{},
+	}
+	if p.usernameMin <= 0 {
+		p.usernameMin = defaultUsernameMinLength
+	}
+	if p.usernameMax <= 0 {
+		p.usernameMax = defaultUsernameMaxLength
+	}
+	if p.usernameMax < p.usernameMin {
+		logger.Fatalf("Invalid username policy, max length %v is less than min length %v", p.usernameMax, p.usernameMin)
+	}
+	if c.Username.Characters != nil {
+		p.characters = *c.Username.Characters
+	}
+	reserved := c.Username.Reserved
+	if reserved == nil {
+		reserved = defaultReservedUsernames
+	}
+	for _, name := range reserved {
+		p.reserved[strings.ToLower(name)] = true
+	}
+
+	if p.passwordMin <= 0 {
+		p.passwordMin = defaultPasswordMinLength
+	}
+	if p.passwordMax <= 0 {
+		p.passwordMax = defaultPasswordMaxLength
+	}
+	if p.passwordMax < p.passwordMin {
+		logger.Fatalf("Invalid password policy, max length %v is less than min length %v", p.passwordMax, p.passwordMin)
+	}
+	for _, class := range c.Password.Require {
+		switch class {
+		case classLower, classUpper, classDigit, classSymbol:
+		default:
+			logger.Fatalf("Unknown password character class %q", class)
+		}
+	}
+	p.require = c.Password.Require
+	for _, pw := range append(defaultPasswordBlocklist, c.Password.Blocklist...) {
+		p.blocklist[strings.ToLower(pw)] = true
+	}
+	if len(c.Password.BlocklistFile) > 0 {
+		if err := p.loadBlocklist(c.Password.BlocklistFile); err != nil {
+			logger.Fatalf("Error reading password blocklist: %v", err)
+		}
+	}
+	return p
+}
+
+func (p *policy) loadBlocklist(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		if pw := strings.TrimSpace(sc.Text()); len(pw) > 0 {
+			p.blocklist[strings.ToLower(pw)] = true
+		}
+	}
+	return sc.Err()
+}
+
+// username checks a lowercased username
+func (p *policy) username(errs *fieldErrors, username string) {
+	p.name(errs, fieldUsername, username)
+}
+
+// name checks a lowercased username or org name, field is the name it was
+// passed as
+func (p *policy) name(errs *fieldErrors, field, name string) {
+	n := utf8.RuneCountInString(name)
+	switch {
+	case n == 0:
+		errs.add(field, codeRequired, "%v is required", field)
+		return
+	case n < p.usernameMin:
+		errs.add(field, codeTooShort, "%v must be at least %v characters", field, p.usernameMin)
+	case n > p.usernameMax:
+		errs.add(field, codeTooLong, "%v must be at most %v characters", field, p.usernameMax)
+	}
+	for _, r := range name {
+		if (r < 'a' || r > 'z') && (r < '0' || r > '9') && !strings.ContainsRune(p.characters, r) {
+			if len(p.characters) > 0 {
+				errs.add(field, codeInvalidCharacters, "%v may only contain letters, numbers and %q", field, p.characters)
+			} else {
+				errs.add(field, codeInvalidCharacters, "%v may only contain letters and numbers", field)
+			}
+			break
+		}
+	}
+	if p.reserved[name] {
+		errs.add(field, codeReserved, "%v %q is reserved", field, name)
+	}
+}
+
+// password checks a new password, field is the name it was passed as
+func (p *policy) password(errs *fieldErrors, field, password string) {
+	n := utf8.RuneCountInString(password)
+	switch {
+	case n == 0:
+		errs.add(field, codeRequired, "%v is required", field)
+		return
+	case n < p.passwordMin:
+		errs.add(field, codeTooShort, "%v must be at least %v characters", field, p.passwordMin)
+	case n > p.passwordMax:
+		errs.add(field, codeTooLong, "%v must be at most %v characters", field, p.passwordMax)
+	}
+	var missing []string
+	for _, class := range p.require {
+		if strings.IndexFunc(password, classes[class]) < 0 {
+			missing = append(missing, class)
+		}
+	}
+	if len(missing) > 0 {
+		errs.add(field, codeMissingCharacters, "%v must contain %v characters", field, strings.Join(missing, ", "))
+	}
+	if p.blocklist[strings.ToLower(password)] {
+		errs.add(field, codeBlocklisted, "%v is too common", field)
+	}
+}
+
+var classes = map[string]func(rune) bool{
+	classLower: unicode.IsLower,
+	classUpper: unicode.IsUpper,
+	classDigit: unicode.IsDigit,
+	classSymbol: func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && !unicode.IsSpace(r)
+	},
+}
@@ -0,0 +1,220 @@
+package handler
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	pb "github.com/embedscript/backend/users/proto"
+	"github.com/micro/micro/v3/service/logger"
+)
+
+const (
+	fieldUsername    = "username"
+	fieldEmail       = "email"
+	fieldDisplayName = "displayName"
+	fieldAvatarURL   = "avatarUrl"
+	fieldMetadata    = "metadata"
+
+	defaultMaxDisplayName   = 100
+	defaultMaxAvatarURL     = 2048
+	defaultMaxMetadataKeys  = 32
+	defaultMaxMetadataValue = 1024
+)
+
+type fieldRule struct {
+	Required  bool `json:"required"`
+	MinLength int  `json:"min_length"`
+	MaxLength int  `json:"max_length"`
+	// regular expression the whole value has to match
+	Pattern string `json:"pattern"`
+}
+
+type profileConf struct {
+	// validation rules by field, eg. displayName, avatarUrl or metadata.<key>
+	Fields map[string]fieldRule `json:"fields"`
+	// if set only these metadata keys are accepted
+	MetadataKeys     []string `json:"metadata_keys"`
+	MaxMetadataKeys  int      `json:"max_metadata_keys"`
+	MaxMetadataValue int      `json:"max_metadata_value"`
+}
+
+type rule struct {
+	fieldRule
+	pattern *regexp.Regexp
+}
+
+// profile validates the profile fields of users against the configured rules
+type profile struct {
+	rules            map[string]rule
+	metadataKeys     map[string]bool
+	maxMetadataKeys  int
+	maxMetadataValue int
+}
+
+func newProfile(c profileConf) *profile {
+	p := &profile{
+		rules: map[string]rule{
+			fieldDisplayName: {fieldRule: fieldRule{MaxLength: defaultMaxDisplayName}},
+			fieldAvatarURL:   {fieldRule: fieldRule{MaxLength: defaultMaxAvatarURL}},
+		},
+		maxMetadataKeys:  c.MaxMetadataKeys,
+		maxMetadataValue: c.MaxMetadataValue,
+	}
+	for name, fr := range c.Fields {
+		if name != fieldDisplayName && name != fieldAvatarURL && !strings.HasPrefix(name, fieldMetadata+".") {
+			logger.Fatalf("Invalid profile field %q", name)
+		}
+		r := rule{fieldRule: fr}
+		if len(fr.Pattern) > 0 {
+			re, err := regexp.Compile("^(?:" + fr.Pattern + ")$")
+			if err != nil {
+				logger.Fatalf("Invalid pattern for profile field %q: %v", name, err)
+			}
+			r.pattern = re
+		}
+		p.rules[name] = r
+	}
+	if len(c.MetadataKeys) > 0 {
+		p.metadataKeys = map[string]bool{}
+		for _, k := range c.MetadataKeys {
+			p.metadataKeys[k] = true
+		}
+	}
+	if p.maxMetadataKeys <= 0 {
+		p.maxMetadataKeys = defaultMaxMetadataKeys
+	}
+	if p.maxMetadataValue <= 0 {
+		p.maxMetadataValue = defaultMaxMetadataValue
+	}
+	return p
+}
+
+func (r rule) validate(errs *fieldErrors, name, val string) {
+	n := utf8.RuneCountInString(val)
+	if n == 0 {
+		if r.Required {
+			errs.add(name, codeRequired, "%v is required", name)
+		}
+		return
+	}
+	if n < r.MinLength {
+		errs.add(name, codeTooShort, "%v must be at least %v characters", name, r.MinLength)
+		return
+	}
+	if r.MaxLength > 0 && n > r.MaxLength {
+		errs.add(name, codeTooLong, "%v must be at most %v characters", name, r.MaxLength)
+		return
+	}
+	if r.pattern != nil && !r.pattern.MatchString(val) {
+		errs.add(name, codeInvalid, "%v is invalid", name)
+	}
+}
+
+// validate checks the profile fields of a user
+func (p *profile) validate(errs *fieldErrors, usr *pb.User) {
+	p.rules[fieldDisplayName].validate(errs, fieldDisplayName, usr.DisplayName)
+	p.rules[fieldAvatarURL].validate(errs, fieldAvatarURL, usr.AvatarUrl)
+	if len(usr.AvatarUrl) > 0 {
+		u, err := url.Parse(usr.AvatarUrl)
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") || len(u.Host) == 0 {
+			errs.add(fieldAvatarURL, codeInvalid, "%v must be an http or https url", fieldAvatarURL)
+		}
+	}
+
+	if len(usr.Metadata) > p.maxMetadataKeys {
+		errs.add(fieldMetadata, codeTooLong, "%v can have at most %v keys", fieldMetadata, p.maxMetadataKeys)
+	}
+	keys := make([]string, 0, len(usr.Metadata))
+	for k := range usr.Metadata {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		v := usr.Metadata[k]
+		name := fieldMetadata + "." + k
+		if len(k) == 0 {
+			errs.add(fieldMetadata, codeInvalid, "%v keys can't be blank", fieldMetadata)
+			continue
+		}
+		if p.metadataKeys != nil && !p.metadataKeys[k] {
+			errs.add(name, codeNotAllowed, "%v is not allowed", name)
+			continue
+		}
+		if utf8.RuneCountInString(v) > p.maxMetadataValue {
+			errs.add(name, codeTooLong, "%v must be at most %v characters", name, p.maxMetadataValue)
+		}
+	}
+	// rules for keys that aren't set, eg. required ones
+	for name, r := range p.rules {
+		if !strings.HasPrefix(name, fieldMetadata+".") {
+			continue
+		}
+		r.validate(errs, name, usr.Metadata[strings.TrimPrefix(name, fieldMetadata+".")])
+	}
+}
+
+// applyUpdate copies the fields in the update mask from the request onto the
+// user. Without a mask every field set in the request is copied, and
+// metadata keys are merged into the existing ones.
+func applyUpdate(usr *pb.User, req *pb.UpdateRequest) error {
+	if len(req.UpdateMask) == 0 {
+		if len(req.Username) > 0 {
+			usr.Username = strings.ToLower(req.Username)
+		}
+		if len(req.Email) > 0 {
+			usr.Email = strings.ToLower(req.Email)
+		}
+		if len(req.DisplayName) > 0 {
+			usr.DisplayName = req.DisplayName
+		}
+		if len(req.AvatarUrl) > 0 {
+			usr.AvatarUrl = req.AvatarUrl
+		}
+		for k, v := range req.Metadata {
+			setMetadata(usr, k, v)
+		}
+		return nil
+	}
+
+	for _, path := range req.UpdateMask {
+		switch path {
+		case fieldUsername:
+			usr.Username = strings.ToLower(req.Username)
+		case fieldEmail:
+			usr.Email = strings.ToLower(req.Email)
+		case fieldDisplayName:
+			usr.DisplayName = req.DisplayName
+		case fieldAvatarURL:
+			usr.AvatarUrl = req.AvatarUrl
+		case fieldMetadata:
+			usr.Metadata = map[string]string{}
+			for k, v := range req.Metadata {
+				setMetadata(usr, k, v)
+			}
+		default:
+			if !strings.HasPrefix(path, fieldMetadata+".") {
+				return fmt.Errorf("unknown field %q in update mask", path)
+			}
+			// a key in the mask that's missing from the request is removed
+			k := strings.TrimPrefix(path, fieldMetadata+".")
+			setMetadata(usr, k, req.Metadata[k])
+		}
+	}
+	return nil
+}
+
+// setMetadata sets a metadata key, a blank value removes it
+func setMetadata(usr *pb.User, k, v string) {
+	if len(v) == 0 {
+		delete(usr.Metadata, k)
+		return
+	}
+	if usr.Metadata == nil {
+		usr.Metadata = map[string]string{}
+	}
+	usr.Metadata[k] = v
+}
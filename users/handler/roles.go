@@ -0,0 +1,273 @@
+package handler
+
+import (
+	"github.com/embedscript/backend/users/domain"
+	pb "github.com/embedscript/backend/users/proto"
+	"github.com/micro/micro/v3/service/errors"
+	"golang.org/x/net/context"
+)
+
+// permissionRoles is needed on role/<name> to save or delete a role, and on
+// user/<id> to change the roles and permissions of a user
+const permissionRoles = "users.roles"
+
+func toPermission(p *pb.Permission) domain.Permission {
+	return domain.Permission{Name: p.Name, Resource: p.Resource}
+}
+
+func fromPermissions(ps []domain.Permission) []*pb.Permission {
+	rsp := make([]*pb.Permission, len(ps))
+	for i, p := range ps {
+		rsp[i] = &pb.Permission{Name: p.Name, Resource: p.Resource}
+	}
+	return rsp
+}
+
+// withRoles sets the current roles of the user on a session, so roles
+// assigned or revoked after login take effect straight away. The same goes
+// for the role in the active org, which is switched off if the user left it.
+func withRoles(d *domain.Domain, sess *pb.Session) error {
+	g, err := d.ReadGrants(sess.UserId)
+	if err != nil {
+		return err
+	}
+	sess.Roles = g.Roles
+	if len(sess.OrgId) == 0 {
+		sess.OrgRole = ""
+		return nil
+	}
+	m, err := d.ReadMembership(sess.OrgId, sess.UserId)
+	if err != nil {
+		return err
+	}
+	if m == nil {
+		sess.OrgId, sess.OrgRole = "", ""
+		return nil
+	}
+	sess.OrgRole = m.Role
+	return nil
+}
+
+func (s *Users) SaveRole(ctx context.Context, req *pb.SaveRoleRequest, rsp *pb.SaveRoleResponse) error {
+	d, err := s.domain(req.Tenant)
+	if err != nil {
+		return err
+	}
+	if req.Role == nil || !domain.ValidRole(req.Role.Name) {
+		return errors.BadRequest("users.SaveRole", domain.ErrInvalidRole.Error())
+	}
+	if err := s.authorize(ctx, d, "users.SaveRole", req.SessionId, permissionRoles, "role/"+req.Role.Name); err != nil {
+		return err
+	}
+	role, err := d.ReadRole(req.Role.Name)
+	if err != nil {
+		return errors.InternalServerError("users.SaveRole", err.Error())
+	}
+	if role == nil {
+		role = &domain.Role{ID: req.Role.Name, Created: s.now().Unix()}
+	}
+	role.Permissions = []domain.Permission{}
+	for _, p := range req.Role.Permissions {
+		if len(p.Name) == 0 {
+			return errors.BadRequest("users.SaveRole", "Missing permission name")
+		}
+		role.Permissions = append(role.Permissions, toPermission(p))
+	}
+	role.Updated = s.now().Unix()
+	if err := d.SaveRole(role); err != nil {
+		return errors.InternalServerError("users.SaveRole", err.Error())
+	}
+	return nil
+}
+
+// DeleteRole deletes a role. Users it was assigned to keep the name but lose
+// its permissions, and get them back if a role with the same name is saved.
+func (s *Users) DeleteRole(ctx context.Context, req *pb.DeleteRoleRequest, rsp *pb.DeleteRoleResponse) error {
+	d, err := s.domain(req.Tenant)
+	if err != nil {
+		return err
+	}
+	if len(req.Name) == 0 {
+		return errors.BadRequest("users.DeleteRole", "Missing role name")
+	}
+	if err := s.authorize(ctx, d, "users.DeleteRole", req.SessionId, permissionRoles, "role/"+req.Name); err != nil {
+		return err
+	}
+	if err := d.DeleteRole(req.Name); err != nil {
+		return errors.InternalServerError("users.DeleteRole", err.Error())
+	}
+	return nil
+}
+
+func (s *Users) ListRoles(ctx context.Context, req *pb.ListRolesRequest, rsp *pb.ListRolesResponse) error {
+	d, err := s.domain(req.Tenant)
+	if err != nil {
+		return err
+	}
+	roles, err := d.ListRoles()
+	if err != nil {
+		return errors.InternalServerError("users.ListRoles", err.Error())
+	}
+	for _, r := range roles {
+		rsp.Roles = append(rsp.Roles, &pb.Role{
+			Name:        r.ID,
+			Permissions: fromPermissions(r.Permissions),
+			Created:     r.Created,
+			Updated:     r.Updated,
+		})
+	}
+	return nil
+}
+
+func (s *Users) AssignRole(ctx context.Context, req *pb.AssignRoleRequest, rsp *pb.AssignRoleResponse) error {
+	d, err := s.domain(req.Tenant)
+	if err != nil {
+		return err
+	}
+	if err := s.authorize(ctx, d, "users.AssignRole", req.SessionId, permissionRoles, "user/"+req.UserId); err != nil {
+		return err
+	}
+	if _, err := d.Read(req.UserId); err != nil {
+		return errors.NotFound("users.AssignRole", "User not found")
+	}
+	role, err := d.ReadRole(req.Role)
+	if err != nil {
+		return errors.InternalServerError("users.AssignRole", err.Error())
+	}
+	if role == nil {
+		return errors.NotFound("users.AssignRole", "Role not found")
+	}
+	g, err := d.ReadGrants(req.UserId)
+	if err != nil {
+		return errors.InternalServerError("users.AssignRole", err.Error())
+	}
+	if !g.AddRole(role.ID) {
+		return nil
+	}
+	if err := d.SaveGrants(g); err != nil {
+		return errors.InternalServerError("users.AssignRole", err.Error())
+	}
+	return nil
+}
+
+func (s *Users) RevokeRole(ctx context.Context, req *pb.RevokeRoleRequest, rsp *pb.RevokeRoleResponse) error {
+	d, err := s.domain(req.Tenant)
+	if err != nil {
+		return err
+	}
+	if err := s.authorize(ctx, d, "users.RevokeRole", req.SessionId, permissionRoles, "user/"+req.UserId); err != nil {
+		return err
+	}
+	g, err := d.ReadGrants(req.UserId)
+	if err != nil {
+		return errors.InternalServerError("users.RevokeRole", err.Error())
+	}
+	if !g.RemoveRole(req.Role) {
+		return nil
+	}
+	if err := d.SaveGrants(g); err != nil {
+		return errors.InternalServerError("users.RevokeRole", err.Error())
+	}
+	return nil
+}
+
+func (s *Users) GrantPermission(ctx context.Context, req *pb.GrantPermissionRequest, rsp *pb.GrantPermissionResponse) error {
+	d, err := s.domain(req.Tenant)
+	if err != nil {
+		return err
+	}
+	if err := s.authorize(ctx, d, "users.GrantPermission", req.SessionId, permissionRoles, "user/"+req.UserId); err != nil {
+		return err
+	}
+	if req.Permission == nil || len(req.Permission.Name) == 0 {
+		return errors.BadRequest("users.GrantPermission", "Missing permission name")
+	}
+	if _, err := d.Read(req.UserId); err != nil {
+		return errors.NotFound("users.GrantPermission", "User not found")
+	}
+	g, err := d.ReadGrants(req.UserId)
+	if err != nil {
+		return errors.InternalServerError("users.GrantPermission", err.Error())
+	}
+	if !g.AddPermission(toPermission(req.Permission)) {
+		return nil
+	}
+	if err := d.SaveGrants(g); err != nil {
+		return errors.InternalServerError("users.GrantPermission", err.Error())
+	}
+	return nil
+}
+
+func (s *Users) RevokePermission(ctx context.Context, req *pb.RevokePermissionRequest, rsp *pb.RevokePermissionResponse) error {
+	d, err := s.domain(req.Tenant)
+	if err != nil {
+		return err
+	}
+	if err := s.authorize(ctx, d, "users.RevokePermission", req.SessionId, permissionRoles, "user/"+req.UserId); err != nil {
+		return err
+	}
+	if req.Permission == nil {
+		return errors.BadRequest("users.RevokePermission", "Missing permission")
+	}
+	g, err := d.ReadGrants(req.UserId)
+	if err != nil {
+		return errors.InternalServerError("users.RevokePermission", err.Error())
+	}
+	if !g.RemovePermission(toPermission(req.Permission)) {
+		return nil
+	}
+	if err := d.SaveGrants(g); err != nil {
+		return errors.InternalServerError("users.RevokePermission", err.Error())
+	}
+	return nil
+}
+
+func (s *Users) ReadGrants(ctx context.Context, req *pb.ReadGrantsRequest, rsp *pb.ReadGrantsResponse) error {
+	d, err := s.domain(req.Tenant)
+	if err != nil {
+		return err
+	}
+	g, err := d.ReadGrants(req.UserId)
+	if err != nil {
+		return errors.InternalServerError("users.ReadGrants", err.Error())
+	}
+	rsp.Roles = g.Roles
+	rsp.Permissions = fromPermissions(g.Permissions)
+	return nil
+}
+
+func (s *Users) Authorize(ctx context.Context, req *pb.AuthorizeRequest, rsp *pb.AuthorizeResponse) error {
+	d, err := s.domain(req.Tenant)
+	if err != nil {
+		return err
+	}
+	if len(req.SessionId) == 0 {
+		return errors.Unauthorized("users.Authorize", "Missing session id")
+	}
+	if len(req.Permission) == 0 {
+		return errors.BadRequest("users.Authorize", "Missing permission")
+	}
+	sess, err := d.ReadSession(req.SessionId)
+	if err != nil {
+		return errors.Unauthorized("users.Authorize", "Invalid session")
+	}
+	// an admin impersonating a user only gets their permissions for actions
+	// the caller says are fine to do while impersonating, eg. reading
+	if impersonated(sess) && !req.AllowImpersonated {
+		return errors.Forbidden("users.Authorize", "Impersonated sessions can't do this")
+	}
+	g, err := d.ReadGrants(sess.UserId)
+	if err != nil {
+		return errors.InternalServerError("users.Authorize", err.Error())
+	}
+	ok, err := d.Authorize(g, req.Permission, req.Resource)
+	if err != nil {
+		return errors.InternalServerError("users.Authorize", err.Error())
+	}
+	if !ok {
+		return errors.Forbidden("users.Authorize", "Not allowed to %v %v", req.Permission, req.Resource)
+	}
+	sess.Roles = g.Roles
+	rsp.Session = sess
+	return nil
+}
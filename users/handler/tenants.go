@@ -0,0 +1,56 @@
+package handler
+
+// tenantConf holds the settings that can be set per tenant under
+// tenants.<id>. Settings that aren't set fall back to the top level ones.
+type tenantConf struct {
+	// create accounts for unknown emails that request a login link
+	LoginLinkSignup *bool `json:"login_link_signup"`
+	// require an invite code to sign up
+	InviteOnly *bool `json:"invite_only"`
+	// username and password policy, merged into the top level one
+	Policy *policyConf `json:"policy"`
+}
+
+// tenant returns the settings of a tenant
+func (s *Users) tenant(id string) tenantConf {
+	return s.config.Tenants[id]
+}
+
+// newPolicies returns the policies of the tenants that have one set
+func newPolicies(c conf) map[string]*policy {
+	policies := map[string]*policy{}
+	for id, tc := range c.Tenants {
+		if tc.Policy != nil {
+			policies[id] = newPolicy(c.Policy.merge(tc.Policy))
+		}
+	}
+	return policies
+}
+
+// policy returns the username and password policy of a tenant
+func (s *Users) policy(tenant string) *policy {
+	if p, ok := s.policies[tenant]; ok {
+		return p
+	}
+	return s.defaultPolicy
+}
+
+// loginLinkSignup reports whether login links create accounts in a tenant,
+// they never do in invite only tenants
+func (s *Users) loginLinkSignup(tenant string) bool {
+	if s.inviteOnly(tenant) {
+		return false
+	}
+	if v := s.tenant(tenant).LoginLinkSignup; v != nil {
+		return *v
+	}
+	return s.config.LoginLink.Signup
+}
+
+// inviteOnly reports whether signing up to a tenant needs an invite code
+func (s *Users) inviteOnly(tenant string) bool {
+	if v := s.tenant(tenant).InviteOnly; v != nil {
+		return *v
+	}
+	return s.config.InviteOnly
+}
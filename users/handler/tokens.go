@@ -0,0 +1,243 @@
+package handler
+
+import (
+	"crypto/rsa"
+	"sync"
+	"time"
+
+	"github.com/embedscript/backend/users/domain"
+	"github.com/embedscript/backend/users/jwt"
+	pb "github.com/embedscript/backend/users/proto"
+	"github.com/google/uuid"
+	"github.com/micro/micro/v3/service/errors"
+	"github.com/micro/micro/v3/service/logger"
+	"golang.org/x/net/context"
+)
+
+const (
+	defaultAccessTokenTTL = 15 * time.Minute
+	defaultKeyRotation    = 7 * 24 * time.Hour
+	defaultTokenIssuer    = "users"
+)
+
+type jwtConf struct {
+	// issue access tokens along with sessions
+	Enabled bool `json:"enabled"`
+	// how long an access token is valid for, eg. "15m"
+	TTL string `json:"ttl"`
+	// how often a new signing key is generated, eg. "168h"
+	Rotation string `json:"rotation"`
+	// the iss claim of access tokens
+	Issuer string `json:"issuer"`
+}
+
+// accessClaims are the claims of an access token
+type accessClaims struct {
+	jwt.Claims
+	Tenant   string   `json:"tenant"`
+	Username string   `json:"username"`
+	Email    string   `json:"email"`
+	Roles    []string `json:"roles"`
+	// Session is the handle of the session the token was issued for, the id
+	// itself is a credential so it's not put in a token anyone can read
+	Session string `json:"sid"`
+	// Actor is the admin impersonating the user, as in RFC 8693
+	Actor *actor `json:"act,omitempty"`
+	// Org is the active org of the session and OrgRole the user's role in it
+	Org     string `json:"org,omitempty"`
+	OrgRole string `json:"org_role,omitempty"`
+}
+
+type actor struct {
+	Subject string `json:"sub"`
+}
+
+// signer signs access tokens with the newest key and rotates keys
+type signer struct {
+	keys     *domain.Keys
+	enabled  bool
+	issuer   string
+	ttl      time.Duration
+	rotation time.Duration
+
+	sync.Mutex
+	// parsed private keys by id
+	parsed map[string]*rsa.PrivateKey
+}
+
+func newSigner(c jwtConf) *signer {
+	s := &signer{
+		keys:     domain.NewKeys(),
+		enabled:  c.Enabled,
+		issuer:   c.Issuer,
+		ttl:      parseDuration("jwt.ttl", c.TTL, defaultAccessTokenTTL),
+		rotation: parseDuration("jwt.rotation", c.Rotation, defaultKeyRotation),
+		parsed:   map[string]*rsa.PrivateKey{},
+	}
+	if len(s.issuer) == 0 {
+		s.issuer = defaultTokenIssuer
+	}
+	return s
+}
+
+func (s *signer) privateKey(key *domain.SigningKey) (*rsa.PrivateKey, error) {
+	s.Lock()
+	defer s.Unlock()
+	if pk, ok := s.parsed[key.ID]; ok {
+		return pk, nil
+	}
+	pk, err := jwt.DecodeKey(key.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	s.parsed[key.ID] = pk
+	return pk, nil
+}
+
+// signingKey returns the newest key, a new one is generated if it's due to
+// be rotated
+func (s *signer) signingKey(now time.Time) (*domain.SigningKey, error) {
+	keys, err := s.keys.List()
+	if err != nil {
+		return nil, err
+	}
+	if n := len(keys); n > 0 && now.Sub(time.Unix(keys[n-1].Created, 0)) < s.rotation {
+		return keys[n-1], nil
+	}
+
+	pk, err := jwt.NewKey()
+	if err != nil {
+		return nil, err
+	}
+	key := &domain.SigningKey{
+		ID:         uuid.New().String(),
+		PrivateKey: jwt.EncodeKey(pk),
+		Created:    now.Unix(),
+		// tokens signed just before the next rotation are valid for another ttl
+		Expires: now.Add(s.rotation + s.ttl).Unix(),
+	}
+	if err := s.keys.Save(key); err != nil {
+		return nil, err
+	}
+	logger.Infof("Generated signing key %v", key.ID)
+	return key, nil
+}
+
+// sign returns an access token for a session along with its refresh token
+func (s *signer) sign(sess *pb.Session, refreshToken string, now time.Time) (*pb.Token, error) {
+	key, err := s.signingKey(now)
+	if err != nil {
+		return nil, err
+	}
+	pk, err := s.privateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	expires := now.Add(s.ttl)
+	// the token can't outlive the session it was issued for
+	if sess.Expires < expires.Unix() {
+		expires = time.Unix(sess.Expires, 0)
+	}
+	var act *actor
+	if len(sess.ImpersonatorId) > 0 {
+		act = &actor{Subject: sess.ImpersonatorId}
+	}
+	tok, err := jwt.Sign(key.ID, pk, accessClaims{
+		Claims: jwt.Claims{
+			Issuer:    s.issuer,
+			Subject:   sess.UserId,
+			ID:        uuid.New().String(),
+			IssuedAt:  now.Unix(),
+			ExpiresAt: expires.Unix(),
+		},
+		Tenant:   sess.Tenant,
+		Username: sess.Username,
+		Email:    sess.Email,
+		Roles:    sess.Roles,
+		Session:  domain.SessionHandle(sess.Id),
+		Actor:    act,
+		Org:      sess.OrgId,
+		OrgRole:  sess.OrgRole,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &pb.Token{
+		AccessToken:  tok,
+		RefreshToken: refreshToken,
+		Expires:      expires.Unix(),
+	}, nil
+}
+
+// rotate deletes keys no valid token can have been signed with
+func (s *signer) rotate(now time.Time) {
+	keys, err := s.keys.List()
+	if err != nil {
+		logger.Errorf("Error listing signing keys: %v", err)
+		return
+	}
+	for _, key := range keys {
+		if key.Expires >= now.Unix() {
+			continue
+		}
+		if err := s.keys.Delete(key.ID); err != nil {
+			logger.Errorf("Error deleting signing key %v: %v", key.ID, err)
+			continue
+		}
+		s.Lock()
+		delete(s.parsed, key.ID)
+		s.Unlock()
+		logger.Infof("Deleted expired signing key %v", key.ID)
+	}
+}
+
+// token returns an access token for a session if they're enabled. A nil
+// session, eg. when a two factor challenge was returned instead, gets no
+// token either. The refresh token is random and single use, only its hash
+// is stored along with the session it refreshes.
+func (s *Users) token(d *domain.Domain, sess *pb.Session) (*pb.Token, error) {
+	if !s.signer.enabled || sess == nil {
+		return nil, nil
+	}
+	now := s.now()
+	refresh := random(32)
+	expires := time.Unix(sess.Created, 0).Add(s.sessionMaxLifetime)
+	if err := d.CreateTokenWithData(domain.TokenRefresh, refresh, sess.UserId, sess.Id, expires); err != nil {
+		return nil, err
+	}
+	return s.signer.sign(sess, refresh, now)
+}
+
+// PublicKeys returns the keys access tokens are verified with as a JWK set
+func (s *Users) PublicKeys(ctx context.Context, req *pb.PublicKeysRequest, rsp *pb.PublicKeysResponse) error {
+	// make sure the key tokens are about to be signed with is published
+	if s.signer.enabled {
+		if _, err := s.signer.signingKey(s.now()); err != nil {
+			return errors.InternalServerError("users.PublicKeys", err.Error())
+		}
+	}
+	keys, err := s.signer.keys.List()
+	if err != nil {
+		return errors.InternalServerError("users.PublicKeys", err.Error())
+	}
+	now := s.now().Unix()
+	for _, key := range keys {
+		if key.Expires < now {
+			continue
+		}
+		pk, err := s.signer.privateKey(key)
+		if err != nil {
+			return errors.InternalServerError("users.PublicKeys", err.Error())
+		}
+		jwk := jwt.PublicJWK(key.ID, &pk.PublicKey)
+		rsp.Keys = append(rsp.Keys, &pb.JWK{
+			Kty: jwk.Kty,
+			Kid: jwk.Kid,
+			Use: jwk.Use,
+			Alg: jwk.Alg,
+			N:   jwk.N,
+			E:   jwk.E,
+		})
+	}
+	return nil
+}
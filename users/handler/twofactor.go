@@ -0,0 +1,223 @@
+package handler
+
+import (
+	"strings"
+	"time"
+
+	"github.com/embedscript/backend/users/domain"
+	pb "github.com/embedscript/backend/users/proto"
+	"github.com/embedscript/backend/users/totp"
+	"github.com/micro/micro/v3/service/errors"
+	"golang.org/x/net/context"
+)
+
+const (
+	challengeExpiry = 5 * time.Minute
+	// codes entered for a login challenge before it has to start over
+	maxChallengeAttempts = 5
+	recoveryCodeCount    = 10
+	// time steps either side of now a code is accepted for
+	codeSkew = 1
+
+	defaultIssuer = "Micro"
+)
+
+type twoFactorConf struct {
+	// name shown in authenticator apps, the tenant is used if it's set
+	Issuer string `json:"issuer"`
+}
+
+// twoFactorCaller checks two factor auth is changed with the user's own
+// session. Impersonated sessions can't, or an admin could lock the user out
+// or leave them with a second factor only the admin knows.
+func (s *Users) twoFactorCaller(d *domain.Domain, id, sessionID, userID string) error {
+	caller, err := callerSession(d, id, sessionID, userID)
+	if err != nil {
+		return err
+	}
+	if impersonated(caller) {
+		return errors.Forbidden(id, "Impersonated sessions can't change two factor auth")
+	}
+	return nil
+}
+
+func (s *Users) Enable2FA(ctx context.Context, req *pb.Enable2FARequest, rsp *pb.Enable2FAResponse) error {
+	d, err := s.domain(req.Tenant)
+	if err != nil {
+		return err
+	}
+	if err := s.twoFactorCaller(d, "users.Enable2FA", req.SessionId, req.UserId); err != nil {
+		return err
+	}
+	usr, err := d.Read(req.UserId)
+	if err != nil {
+		return errors.NotFound("users.Enable2FA", "User not found")
+	}
+	tf, err := d.ReadTwoFactor(usr.Id)
+	if err != nil {
+		return errors.InternalServerError("users.Enable2FA", err.Error())
+	}
+	if tf != nil && tf.Enabled {
+		return errors.BadRequest("users.Enable2FA", "Two factor auth is already enabled")
+	}
+
+	secret, err := totp.NewSecret()
+	if err != nil {
+		return errors.InternalServerError("users.Enable2FA", err.Error())
+	}
+	if err := d.SaveTwoFactor(&domain.TwoFactor{ID: usr.Id, Secret: secret}); err != nil {
+		return errors.InternalServerError("users.Enable2FA", err.Error())
+	}
+
+	issuer := d.Tenant()
+	if len(issuer) == 0 {
+		issuer = s.config.TwoFactor.Issuer
+	}
+	if len(issuer) == 0 {
+		issuer = defaultIssuer
+	}
+	account := usr.Username
+	if len(account) == 0 {
+		account = usr.Email
+	}
+	rsp.Secret = secret
+	rsp.Uri = totp.URI(issuer, account, secret)
+	return nil
+}
+
+func (s *Users) Confirm2FA(ctx context.Context, req *pb.Confirm2FARequest, rsp *pb.Confirm2FAResponse) error {
+	d, err := s.domain(req.Tenant)
+	if err != nil {
+		return err
+	}
+	if err := s.twoFactorCaller(d, "users.Confirm2FA", req.SessionId, req.UserId); err != nil {
+		return err
+	}
+	tf, err := d.ReadTwoFactor(req.UserId)
+	if err != nil {
+		return errors.InternalServerError("users.Confirm2FA", err.Error())
+	}
+	if tf == nil {
+		return errors.BadRequest("users.Confirm2FA", "Two factor auth has not been enabled")
+	}
+	if tf.Enabled {
+		return errors.BadRequest("users.Confirm2FA", "Two factor auth is already confirmed")
+	}
+	counter, ok := totp.Validate(req.Code, tf.Secret, s.now(), codeSkew)
+	if !ok {
+		return errors.Unauthorized("users.Confirm2FA", "Invalid code")
+	}
+
+	codes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		codes[i] = strings.ToLower(random(5) + "-" + random(5))
+	}
+	tf.Enabled = true
+	tf.LastCounter = counter
+	tf.SetRecoveryCodes(codes)
+	if err := d.SaveTwoFactor(tf); err != nil {
+		return errors.InternalServerError("users.Confirm2FA", err.Error())
+	}
+	rsp.RecoveryCodes = codes
+	return nil
+}
+
+func (s *Users) Disable2FA(ctx context.Context, req *pb.Disable2FARequest, rsp *pb.Disable2FAResponse) error {
+	d, err := s.domain(req.Tenant)
+	if err != nil {
+		return err
+	}
+	if err := s.twoFactorCaller(d, "users.Disable2FA", req.SessionId, req.UserId); err != nil {
+		return err
+	}
+	tf, err := d.ReadTwoFactor(req.UserId)
+	if err != nil {
+		return errors.InternalServerError("users.Disable2FA", err.Error())
+	}
+	if tf == nil {
+		return nil
+	}
+	if tf.Enabled {
+		ip, _ := clientInfo(ctx)
+		keys := s.lockout.keys(tf.ID, ip)
+		if err := s.lockout.check(d, s.now(), "users.Disable2FA", keys...); err != nil {
+			return err
+		}
+		ok, err := s.checkCode(d, tf, req.Code)
+		if err != nil {
+			return errors.InternalServerError("users.Disable2FA", err.Error())
+		}
+		if !ok {
+			s.lockout.fail(d, s.now(), keys...)
+			return errors.Unauthorized("users.Disable2FA", "Invalid code")
+		}
+		s.lockout.succeed(d, tf.ID)
+	}
+	if err := d.DeleteTwoFactor(tf.ID); err != nil {
+		return errors.InternalServerError("users.Disable2FA", err.Error())
+	}
+	return nil
+}
+
+// loginWithCode is the second step of a two factor login
+func (s *Users) loginWithCode(ctx context.Context, d *domain.Domain, req *pb.LoginRequest, rsp *pb.LoginResponse, ev *domain.AuditEvent) error {
+	userID, err := d.ReadToken(domain.TokenTwoFactorChallenge, req.Challenge, s.now())
+	if err != nil {
+		return errors.Unauthorized("users.Login", err.Error())
+	}
+	ev.UserID = userID
+
+	// codes count against the account and address like passwords do, a
+	// challenge only takes a few codes but a new one is a password away
+	ip, _ := clientInfo(ctx)
+	keys := s.lockout.keys(userID, ip)
+	if err := s.lockout.check(d, s.now(), "users.Login", keys...); err != nil {
+		return err
+	}
+	tf, err := d.ReadTwoFactor(userID)
+	if err != nil {
+		return errors.InternalServerError("users.Login", err.Error())
+	}
+	if tf == nil || !tf.Enabled {
+		return errors.Unauthorized("users.Login", "Two factor auth is not enabled")
+	}
+
+	ok, err := s.checkCode(d, tf, req.Code)
+	if err != nil {
+		return errors.InternalServerError("users.Login", err.Error())
+	}
+	if !ok {
+		s.lockout.fail(d, s.now(), keys...)
+		if err := d.FailToken(domain.TokenTwoFactorChallenge, req.Challenge, maxChallengeAttempts); err != nil {
+			return errors.InternalServerError("users.Login", err.Error())
+		}
+		return errors.Unauthorized("users.Login", "Invalid code")
+	}
+	s.lockout.succeed(d, userID)
+	if err := d.DeleteToken(req.Challenge); err != nil {
+		return errors.InternalServerError("users.Login", err.Error())
+	}
+
+	usr, err := d.Read(userID)
+	if err != nil {
+		return errors.InternalServerError("users.Login", err.Error())
+	}
+	sess, err := s.createSession(ctx, d, usr)
+	if err != nil {
+		return errors.InternalServerError("users.Login", err.Error())
+	}
+	if rsp.Token, err = s.token(d, sess); err != nil {
+		return errors.InternalServerError("users.Login", err.Error())
+	}
+	rsp.Session = sess
+	return nil
+}
+
+// checkCode checks a code from an authenticator app or a recovery code,
+// either can only be used once
+func (s *Users) checkCode(d *domain.Domain, tf *domain.TwoFactor, code string) (bool, error) {
+	if !tf.Verify(code, s.now(), codeSkew) {
+		return false, nil
+	}
+	return true, d.SaveTwoFactor(tf)
+}
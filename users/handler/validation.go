@@ -0,0 +1,59 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	pb "github.com/embedscript/backend/users/proto"
+	"github.com/micro/micro/v3/service/errors"
+)
+
+// codes of field errors
+const (
+	codeRequired          = "required"
+	codeTooShort          = "too_short"
+	codeTooLong           = "too_long"
+	codeInvalid           = "invalid"
+	codeInvalidCharacters = "invalid_characters"
+	codeMissingCharacters = "missing_characters"
+	codeReserved          = "reserved"
+	codeBlocklisted       = "blocklisted"
+	codeNotAllowed        = "not_allowed"
+	codeMismatch          = "mismatch"
+	codeExpired           = "expired"
+	codeUsedUp            = "used_up"
+)
+
+// fieldErrors collects what's wrong with the fields of a request so they can
+// all be returned at once
+type fieldErrors []*pb.FieldError
+
+func (e *fieldErrors) add(field, code, format string, a ...interface{}) {
+	*e = append(*e, &pb.FieldError{
+		Field:   field,
+		Code:    code,
+		Message: fmt.Sprintf(format, a...),
+	})
+}
+
+func (e fieldErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, fe := range e {
+		msgs[i] = fe.Message
+	}
+	return strings.Join(msgs, ", ")
+}
+
+// err returns a bad request error with the field errors encoded as JSON in
+// its detail, or nil if there are none
+func (e fieldErrors) err(id string) error {
+	if len(e) == 0 {
+		return nil
+	}
+	b, err := json.Marshal(&pb.ValidationErrors{Errors: e})
+	if err != nil {
+		return errors.BadRequest(id, "%s", e.Error())
+	}
+	return errors.BadRequest(id, "%s", b)
+}
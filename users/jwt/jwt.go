@@ -0,0 +1,161 @@
+// Package jwt signs and verifies JSON web tokens with RS256 as described in
+// RFC 7519, and encodes the verification keys as a JWK set (RFC 7517).
+package jwt
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"strings"
+	"time"
+)
+
+const (
+	// Algorithm is the only signing algorithm used and accepted
+	Algorithm = "RS256"
+
+	keyBits = 2048
+)
+
+var (
+	ErrInvalidToken = errors.New("token is invalid")
+	ErrExpiredToken = errors.New("token has expired")
+	ErrUnknownKey   = errors.New("token was signed with an unknown key")
+
+	encoding = base64.RawURLEncoding
+)
+
+type header struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ"`
+	Kid string `json:"kid"`
+}
+
+// Claims are the registered claims checked by Verify, embed them in a struct
+// to add others
+type Claims struct {
+	Issuer    string `json:"iss,omitempty"`
+	Subject   string `json:"sub,omitempty"`
+	ID        string `json:"jti,omitempty"`
+	IssuedAt  int64  `json:"iat,omitempty"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// Expiry returns when the token expires
+func (c Claims) Expiry() time.Time {
+	return time.Unix(c.ExpiresAt, 0)
+}
+
+type expirer interface {
+	Expiry() time.Time
+}
+
+// NewKey generates a private key
+func NewKey() (*rsa.PrivateKey, error) {
+	return rsa.GenerateKey(rand.Reader, keyBits)
+}
+
+// EncodeKey encodes a private key as PEM to store it
+func EncodeKey(key *rsa.PrivateKey) string {
+	return string(pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(key),
+	}))
+}
+
+// DecodeKey decodes a private key encoded with EncodeKey
+func DecodeKey(s string) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(s))
+	if block == nil {
+		return nil, errors.New("invalid private key")
+	}
+	return x509.ParsePKCS1PrivateKey(block.Bytes)
+}
+
+// Sign returns a token with the claims signed by the key with the given id
+func Sign(kid string, key *rsa.PrivateKey, claims interface{}) (string, error) {
+	h, err := json.Marshal(header{Alg: Algorithm, Typ: "JWT", Kid: kid})
+	if err != nil {
+		return "", err
+	}
+	c, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signed := encoding.EncodeToString(h) + "." + encoding.EncodeToString(c)
+	sum := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, sum[:])
+	if err != nil {
+		return "", err
+	}
+	return signed + "." + encoding.EncodeToString(sig), nil
+}
+
+// Verify checks the signature of a token with the key it names and decodes
+// its claims, which have to implement Expiry by embedding Claims
+func Verify(token string, keys func(kid string) *rsa.PublicKey, claims expirer, now time.Time) error {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return ErrInvalidToken
+	}
+	b, err := encoding.DecodeString(parts[0])
+	if err != nil {
+		return ErrInvalidToken
+	}
+	var h header
+	if err := json.Unmarshal(b, &h); err != nil || h.Alg != Algorithm {
+		return ErrInvalidToken
+	}
+	pub := keys(h.Kid)
+	if pub == nil {
+		return ErrUnknownKey
+	}
+	sig, err := encoding.DecodeString(parts[2])
+	if err != nil {
+		return ErrInvalidToken
+	}
+	sum := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(pub, crypto.SHA256, sum[:], sig); err != nil {
+		return ErrInvalidToken
+	}
+	b, err = encoding.DecodeString(parts[1])
+	if err != nil {
+		return ErrInvalidToken
+	}
+	if err := json.Unmarshal(b, claims); err != nil {
+		return ErrInvalidToken
+	}
+	if !now.Before(claims.Expiry()) {
+		return ErrExpiredToken
+	}
+	return nil
+}
+
+// JWK is a public key in the JSON web key format
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+// PublicJWK returns the JSON web key of a public key
+func PublicJWK(kid string, pub *rsa.PublicKey) JWK {
+	return JWK{
+		Kty: "RSA",
+		Kid: kid,
+		Use: "sig",
+		Alg: Algorithm,
+		N:   encoding.EncodeToString(pub.N.Bytes()),
+		E:   encoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+	}
+}
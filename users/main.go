@@ -1,6 +1,7 @@
 package main
 
 import (
+	eproto "github.com/embedscript/backend/emails/proto"
 	"github.com/embedscript/backend/users/handler"
 	proto "github.com/embedscript/backend/users/proto"
 	"github.com/micro/micro/v3/service"
@@ -14,7 +15,9 @@ func main() {
 
 	service.Init()
 
-	proto.RegisterUsersHandler(service.Server(), handler.NewUsers())
+	proto.RegisterUsersHandler(service.Server(), handler.NewUsers(
+		eproto.NewEmailsService("emails", service.Client()),
+	))
 
 	if err := service.Run(); err != nil {
 		logger.Fatal(err)
@@ -0,0 +1,100 @@
+package oauth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const (
+	githubAuthURL  = "https://github.com/login/oauth/authorize"
+	githubTokenURL = "https://github.com/login/oauth/access_token"
+	githubAPIURL   = "https://api.github.com"
+)
+
+// github signs users in with their GitHub account. GitHub doesn't support
+// OpenID Connect so the identity is read from its REST API.
+type github struct {
+	name   string
+	config Config
+	client *http.Client
+}
+
+type githubUser struct {
+	ID    int64  `json:"id"`
+	Login string `json:"login"`
+	Name  string `json:"name"`
+}
+
+type githubEmail struct {
+	Email    string `json:"email"`
+	Primary  bool   `json:"primary"`
+	Verified bool   `json:"verified"`
+}
+
+func newGithub(name string, c Config, client *http.Client) *github {
+	if len(c.Scopes) == 0 {
+		c.Scopes = []string{"read:user", "user:email"}
+	}
+	if len(c.AuthURL) == 0 {
+		c.AuthURL = githubAuthURL
+	}
+	if len(c.TokenURL) == 0 {
+		c.TokenURL = githubTokenURL
+	}
+	if len(c.APIURL) == 0 {
+		c.APIURL = githubAPIURL
+	}
+	c.APIURL = strings.TrimSuffix(c.APIURL, "/")
+	return &github{name: name, config: c, client: client}
+}
+
+func (g *github) AuthCodeURL(ctx context.Context, state, verifier, redirectURL string) (string, error) {
+	v := url.Values{
+		"client_id":             {g.config.ClientID},
+		"redirect_uri":          {redirectURL},
+		"scope":                 {strings.Join(g.config.Scopes, " ")},
+		"state":                 {state},
+		"code_challenge":        {challenge(verifier)},
+		"code_challenge_method": {"S256"},
+	}
+	return g.config.AuthURL + "?" + v.Encode(), nil
+}
+
+func (g *github) Exchange(ctx context.Context, code, verifier, redirectURL string) (*Identity, error) {
+	tok, err := exchangeCode(ctx, g.client, g.config.TokenURL, g.config, code, verifier, redirectURL)
+	if err != nil {
+		return nil, err
+	}
+	usr := githubUser{}
+	if err := getJSON(ctx, g.client, g.config.APIURL+"/user", tok, &usr); err != nil {
+		return nil, err
+	}
+	if usr.ID == 0 {
+		return nil, errors.New("github user is missing the id")
+	}
+	id := &Identity{
+		Provider: g.name,
+		Subject:  strconv.FormatInt(usr.ID, 10),
+		Username: usr.Login,
+		Name:     usr.Name,
+	}
+
+	// the email on the profile may be hidden or unverified, use the primary
+	// address from the emails endpoint instead
+	emails := []githubEmail{}
+	if err := getJSON(ctx, g.client, g.config.APIURL+"/user/emails", tok, &emails); err != nil {
+		return nil, err
+	}
+	for _, e := range emails {
+		if e.Primary {
+			id.Email = e.Email
+			id.EmailVerified = e.Verified
+			break
+		}
+	}
+	return id, nil
+}
@@ -0,0 +1,190 @@
+// Package oauth implements the authorization code flow against OAuth2 and
+// OpenID Connect providers so users can sign in with an external account.
+package oauth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	TypeOIDC   = "oidc"
+	TypeGithub = "github"
+)
+
+var (
+	ErrUnknownProvider = errors.New("unknown provider")
+	ErrRedirectURL     = errors.New("redirect url is not allowed")
+)
+
+// Identity is an account at a provider
+type Identity struct {
+	Provider string
+	// Subject is the provider's stable id for the account
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Username      string
+	Name          string
+}
+
+// Provider is an OAuth2 identity provider
+type Provider interface {
+	// AuthCodeURL returns the url to send the user to to sign in. The
+	// verifier is the PKCE code verifier which has to be passed to Exchange.
+	AuthCodeURL(ctx context.Context, state, verifier, redirectURL string) (string, error)
+	// Exchange trades the code returned to the redirect url for the
+	// identity of the user who signed in
+	Exchange(ctx context.Context, code, verifier, redirectURL string) (*Identity, error)
+}
+
+// Config configures a provider
+type Config struct {
+	// Type is oidc or github
+	Type         string   `json:"type"`
+	ClientID     string   `json:"client_id"`
+	ClientSecret string   `json:"client_secret"`
+	Scopes       []string `json:"scopes"`
+	// RedirectURLs the provider may redirect back to, any are allowed if empty
+	RedirectURLs []string `json:"redirect_urls"`
+	// Issuer of an oidc provider, eg. https://accounts.google.com
+	Issuer string `json:"issuer"`
+	// AuthURL, TokenURL and APIURL override the github endpoints
+	AuthURL  string `json:"auth_url"`
+	TokenURL string `json:"token_url"`
+	APIURL   string `json:"api_url"`
+}
+
+// Providers holds the configured providers by name
+type Providers struct {
+	providers map[string]Provider
+	redirects map[string][]string
+}
+
+// New returns the providers in the config, keyed by name
+func New(configs map[string]Config) (*Providers, error) {
+	p := &Providers{
+		providers: map[string]Provider{},
+		redirects: map[string][]string{},
+	}
+	client := &http.Client{Timeout: 10 * time.Second}
+	for name, c := range configs {
+		if len(c.ClientID) == 0 {
+			return nil, fmt.Errorf("provider %v: missing client id", name)
+		}
+		switch c.Type {
+		case TypeOIDC:
+			if len(c.Issuer) == 0 {
+				return nil, fmt.Errorf("provider %v: missing issuer", name)
+			}
+			p.providers[name] = newOIDC(name, c, client)
+		case TypeGithub:
+			p.providers[name] = newGithub(name, c, client)
+		default:
+			return nil, fmt.Errorf("provider %v: unknown type %q", name, c.Type)
+		}
+		p.redirects[name] = c.RedirectURLs
+	}
+	return p, nil
+}
+
+// Get returns a provider after checking the redirect url is allowed for it
+func (p *Providers) Get(name, redirectURL string) (Provider, error) {
+	prov, ok := p.providers[name]
+	if !ok {
+		return nil, ErrUnknownProvider
+	}
+	allowed := p.redirects[name]
+	if len(allowed) == 0 {
+		return prov, nil
+	}
+	for _, u := range allowed {
+		if u == redirectURL {
+			return prov, nil
+		}
+	}
+	return nil, ErrRedirectURL
+}
+
+// challenge returns the S256 PKCE code challenge of a verifier
+func challenge(verifier string) string {
+	h := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(h[:])
+}
+
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	Error       string `json:"error"`
+	Description string `json:"error_description"`
+}
+
+// exchangeCode requests an access token for an authorization code
+func exchangeCode(ctx context.Context, client *http.Client, tokenURL string, c Config, code, verifier, redirectURL string) (string, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {redirectURL},
+		"client_id":     {c.ClientID},
+		"client_secret": {c.ClientSecret},
+	}
+	if len(verifier) > 0 {
+		form.Set("code_verifier", verifier)
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	tok := tokenResponse{}
+	if err := do(client, req, &tok); err != nil {
+		return "", err
+	}
+	if len(tok.Error) > 0 {
+		return "", fmt.Errorf("token exchange failed: %v %v", tok.Error, tok.Description)
+	}
+	if len(tok.AccessToken) == 0 {
+		return "", errors.New("token exchange failed: no access token")
+	}
+	return tok.AccessToken, nil
+}
+
+// getJSON requests a url with an access token and decodes the response
+func getJSON(ctx context.Context, client *http.Client, u, accessToken string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if len(accessToken) > 0 {
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+	}
+	return do(client, req, v)
+}
+
+func do(client *http.Client, req *http.Request, v interface{}) error {
+	rsp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer rsp.Body.Close()
+	b, err := ioutil.ReadAll(io.LimitReader(rsp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if rsp.StatusCode < 200 || rsp.StatusCode > 299 {
+		return fmt.Errorf("%v %v: %v %s", req.Method, req.URL.Path, rsp.Status, b)
+	}
+	return json.Unmarshal(b, v)
+}
@@ -0,0 +1,112 @@
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// oidc is a generic OpenID Connect provider. Endpoints are found through
+// discovery and the identity is read from the userinfo endpoint, which is
+// fetched with the access token straight from the provider so the id token
+// doesn't need verifying.
+type oidc struct {
+	name   string
+	config Config
+	client *http.Client
+
+	sync.Mutex
+	discovery *discovery
+}
+
+type discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserinfoEndpoint      string `json:"userinfo_endpoint"`
+}
+
+type userinfo struct {
+	Subject           string          `json:"sub"`
+	Email             string          `json:"email"`
+	EmailVerified     json.RawMessage `json:"email_verified"`
+	Name              string          `json:"name"`
+	PreferredUsername string          `json:"preferred_username"`
+}
+
+func newOIDC(name string, c Config, client *http.Client) *oidc {
+	if len(c.Scopes) == 0 {
+		c.Scopes = []string{"openid", "email", "profile"}
+	}
+	return &oidc{name: name, config: c, client: client}
+}
+
+// discover fetches the provider's endpoints, they're cached once found
+func (o *oidc) discover(ctx context.Context) (*discovery, error) {
+	o.Lock()
+	defer o.Unlock()
+	if o.discovery != nil {
+		return o.discovery, nil
+	}
+	issuer := strings.TrimSuffix(o.config.Issuer, "/")
+	d := &discovery{}
+	if err := getJSON(ctx, o.client, issuer+"/.well-known/openid-configuration", "", d); err != nil {
+		return nil, err
+	}
+	if strings.TrimSuffix(d.Issuer, "/") != issuer {
+		return nil, errors.New("issuer does not match discovery document")
+	}
+	if len(d.AuthorizationEndpoint) == 0 || len(d.TokenEndpoint) == 0 || len(d.UserinfoEndpoint) == 0 {
+		return nil, errors.New("discovery document is missing endpoints")
+	}
+	o.discovery = d
+	return d, nil
+}
+
+func (o *oidc) AuthCodeURL(ctx context.Context, state, verifier, redirectURL string) (string, error) {
+	d, err := o.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	v := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {o.config.ClientID},
+		"redirect_uri":          {redirectURL},
+		"scope":                 {strings.Join(o.config.Scopes, " ")},
+		"state":                 {state},
+		"code_challenge":        {challenge(verifier)},
+		"code_challenge_method": {"S256"},
+	}
+	return d.AuthorizationEndpoint + "?" + v.Encode(), nil
+}
+
+func (o *oidc) Exchange(ctx context.Context, code, verifier, redirectURL string) (*Identity, error) {
+	d, err := o.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	tok, err := exchangeCode(ctx, o.client, d.TokenEndpoint, o.config, code, verifier, redirectURL)
+	if err != nil {
+		return nil, err
+	}
+	info := userinfo{}
+	if err := getJSON(ctx, o.client, d.UserinfoEndpoint, tok, &info); err != nil {
+		return nil, err
+	}
+	if len(info.Subject) == 0 {
+		return nil, errors.New("userinfo is missing the subject")
+	}
+	return &Identity{
+		Provider: o.name,
+		Subject:  info.Subject,
+		Email:    info.Email,
+		// some providers send the flag as a string
+		EmailVerified: string(info.EmailVerified) == "true" || string(info.EmailVerified) == `"true"`,
+		Username:      info.PreferredUsername,
+		Name:          info.Name,
+	}, nil
+}
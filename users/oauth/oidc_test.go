@@ -0,0 +1,175 @@
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// issuer is a stand-in OpenID Connect provider serving discovery, the token
+// endpoint and userinfo for a single authorization code
+type issuer struct {
+	*httptest.Server
+	code     string
+	token    string
+	userinfo string
+	// issuer claimed in the discovery document, the server url if empty
+	claims string
+}
+
+func newIssuer(t *testing.T, userinfo string) *issuer {
+	i := &issuer{code: "code", token: "access-token", userinfo: userinfo}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		iss := i.claims
+		if len(iss) == 0 {
+			iss = i.URL
+		}
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 iss,
+			"authorization_endpoint": i.URL + "/authorize",
+			"token_endpoint":         i.URL + "/token",
+			"userinfo_endpoint":      i.URL + "/userinfo",
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("token request: %v", err)
+		}
+		if r.PostForm.Get("code") != i.code || r.PostForm.Get("client_id") != "client" {
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		if r.PostForm.Get("code_verifier") != "verifier" {
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant", "error_description": "bad verifier"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"access_token": i.token, "token_type": "Bearer"})
+	})
+	mux.HandleFunc("/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+i.token {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(i.userinfo))
+	})
+	i.Server = httptest.NewServer(mux)
+	t.Cleanup(i.Close)
+	return i
+}
+
+func (i *issuer) provider(t *testing.T) Provider {
+	p, err := New(map[string]Config{
+		"test": {Type: TypeOIDC, ClientID: "client", ClientSecret: "secret", Issuer: i.URL},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	prov, err := p.Get("test", "https://example.com/login")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return prov
+}
+
+func TestOIDCExchange(t *testing.T) {
+	tests := []struct {
+		name     string
+		userinfo string
+		want     Identity
+	}{
+		{
+			name:     "verified",
+			userinfo: `{"sub": "123", "email": "asim@example.com", "email_verified": true, "preferred_username": "asim", "name": "Asim"}`,
+			want:     Identity{Provider: "test", Subject: "123", Email: "asim@example.com", EmailVerified: true, Username: "asim", Name: "Asim"},
+		},
+		{
+			name:     "verified as a string",
+			userinfo: `{"sub": "123", "email": "asim@example.com", "email_verified": "true"}`,
+			want:     Identity{Provider: "test", Subject: "123", Email: "asim@example.com", EmailVerified: true},
+		},
+		{
+			name:     "unverified",
+			userinfo: `{"sub": "123", "email": "asim@example.com", "email_verified": false}`,
+			want:     Identity{Provider: "test", Subject: "123", Email: "asim@example.com"},
+		},
+		{
+			name:     "unverified as a string",
+			userinfo: `{"sub": "123", "email": "asim@example.com", "email_verified": "false"}`,
+			want:     Identity{Provider: "test", Subject: "123", Email: "asim@example.com"},
+		},
+		{
+			name:     "no verified claim",
+			userinfo: `{"sub": "123", "email": "asim@example.com"}`,
+			want:     Identity{Provider: "test", Subject: "123", Email: "asim@example.com"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			iss := newIssuer(t, tt.userinfo)
+			id, err := iss.provider(t).Exchange(context.Background(), iss.code, "verifier", "https://example.com/login")
+			if err != nil {
+				t.Fatalf("Exchange() error = %v", err)
+			}
+			if *id != tt.want {
+				t.Errorf("Exchange() = %+v, want %+v", *id, tt.want)
+			}
+		})
+	}
+}
+
+func TestOIDCExchangeErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		userinfo string
+		code     string
+		verifier string
+		claims   string
+	}{
+		{name: "wrong code", code: "other", verifier: "verifier", userinfo: `{"sub": "123"}`},
+		{name: "wrong verifier", code: "code", verifier: "other", userinfo: `{"sub": "123"}`},
+		{name: "missing subject", code: "code", verifier: "verifier", userinfo: `{"email": "asim@example.com", "email_verified": true}`},
+		{name: "issuer mismatch", code: "code", verifier: "verifier", userinfo: `{"sub": "123"}`, claims: "https://accounts.example.com"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			iss := newIssuer(t, tt.userinfo)
+			iss.claims = tt.claims
+			if id, err := iss.provider(t).Exchange(context.Background(), tt.code, tt.verifier, "https://example.com/login"); err == nil {
+				t.Errorf("Exchange() = %+v, want an error", *id)
+			}
+		})
+	}
+}
+
+func TestOIDCAuthCodeURL(t *testing.T) {
+	iss := newIssuer(t, `{"sub": "123"}`)
+	u, err := iss.provider(t).AuthCodeURL(context.Background(), "state", "verifier", "https://example.com/login")
+	if err != nil {
+		t.Fatalf("AuthCodeURL() error = %v", err)
+	}
+	if !strings.HasPrefix(u, iss.URL+"/authorize?") {
+		t.Fatalf("AuthCodeURL() = %v, want the authorization endpoint", u)
+	}
+	parsed, err := url.Parse(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := parsed.Query()
+	want := map[string]string{
+		"client_id":             "client",
+		"redirect_uri":          "https://example.com/login",
+		"state":                 "state",
+		"code_challenge":        challenge("verifier"),
+		"code_challenge_method": "S256",
+	}
+	for k, v := range want {
+		if q.Get(k) != v {
+			t.Errorf("%v = %q, want %q", k, q.Get(k), v)
+		}
+	}
+}
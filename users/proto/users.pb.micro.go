@@ -45,12 +45,63 @@ type UsersService interface {
 	Create(ctx context.Context, in *CreateRequest, opts ...client.CallOption) (*CreateResponse, error)
 	Read(ctx context.Context, in *ReadRequest, opts ...client.CallOption) (*ReadResponse, error)
 	Update(ctx context.Context, in *UpdateRequest, opts ...client.CallOption) (*UpdateResponse, error)
+	ConfirmEmail(ctx context.Context, in *ConfirmEmailRequest, opts ...client.CallOption) (*ConfirmEmailResponse, error)
 	Delete(ctx context.Context, in *DeleteRequest, opts ...client.CallOption) (*DeleteResponse, error)
+	Restore(ctx context.Context, in *RestoreRequest, opts ...client.CallOption) (*RestoreResponse, error)
 	Search(ctx context.Context, in *SearchRequest, opts ...client.CallOption) (*SearchResponse, error)
+	List(ctx context.Context, in *ListRequest, opts ...client.CallOption) (*ListResponse, error)
 	UpdatePassword(ctx context.Context, in *UpdatePasswordRequest, opts ...client.CallOption) (*UpdatePasswordResponse, error)
 	Login(ctx context.Context, in *LoginRequest, opts ...client.CallOption) (*LoginResponse, error)
 	Logout(ctx context.Context, in *LogoutRequest, opts ...client.CallOption) (*LogoutResponse, error)
 	ReadSession(ctx context.Context, in *ReadSessionRequest, opts ...client.CallOption) (*ReadSessionResponse, error)
+	Verify(ctx context.Context, in *VerifyRequest, opts ...client.CallOption) (*VerifyResponse, error)
+	ResendVerification(ctx context.Context, in *ResendVerificationRequest, opts ...client.CallOption) (*ResendVerificationResponse, error)
+	RequestPasswordReset(ctx context.Context, in *RequestPasswordResetRequest, opts ...client.CallOption) (*RequestPasswordResetResponse, error)
+	ResetPassword(ctx context.Context, in *ResetPasswordRequest, opts ...client.CallOption) (*ResetPasswordResponse, error)
+	RefreshSession(ctx context.Context, in *RefreshSessionRequest, opts ...client.CallOption) (*RefreshSessionResponse, error)
+	ListSessions(ctx context.Context, in *ListSessionsRequest, opts ...client.CallOption) (*ListSessionsResponse, error)
+	RevokeAllSessions(ctx context.Context, in *RevokeAllSessionsRequest, opts ...client.CallOption) (*RevokeAllSessionsResponse, error)
+	RevokeSession(ctx context.Context, in *RevokeSessionRequest, opts ...client.CallOption) (*RevokeSessionResponse, error)
+	Enable2FA(ctx context.Context, in *Enable2FARequest, opts ...client.CallOption) (*Enable2FAResponse, error)
+	Confirm2FA(ctx context.Context, in *Confirm2FARequest, opts ...client.CallOption) (*Confirm2FAResponse, error)
+	Disable2FA(ctx context.Context, in *Disable2FARequest, opts ...client.CallOption) (*Disable2FAResponse, error)
+	OAuthURL(ctx context.Context, in *OAuthURLRequest, opts ...client.CallOption) (*OAuthURLResponse, error)
+	OAuthLogin(ctx context.Context, in *OAuthLoginRequest, opts ...client.CallOption) (*OAuthLoginResponse, error)
+	Unlock(ctx context.Context, in *UnlockRequest, opts ...client.CallOption) (*UnlockResponse, error)
+	SendLoginLink(ctx context.Context, in *SendLoginLinkRequest, opts ...client.CallOption) (*SendLoginLinkResponse, error)
+	RedeemLoginLink(ctx context.Context, in *RedeemLoginLinkRequest, opts ...client.CallOption) (*RedeemLoginLinkResponse, error)
+	SaveRole(ctx context.Context, in *SaveRoleRequest, opts ...client.CallOption) (*SaveRoleResponse, error)
+	DeleteRole(ctx context.Context, in *DeleteRoleRequest, opts ...client.CallOption) (*DeleteRoleResponse, error)
+	ListRoles(ctx context.Context, in *ListRolesRequest, opts ...client.CallOption) (*ListRolesResponse, error)
+	AssignRole(ctx context.Context, in *AssignRoleRequest, opts ...client.CallOption) (*AssignRoleResponse, error)
+	RevokeRole(ctx context.Context, in *RevokeRoleRequest, opts ...client.CallOption) (*RevokeRoleResponse, error)
+	GrantPermission(ctx context.Context, in *GrantPermissionRequest, opts ...client.CallOption) (*GrantPermissionResponse, error)
+	RevokePermission(ctx context.Context, in *RevokePermissionRequest, opts ...client.CallOption) (*RevokePermissionResponse, error)
+	ReadGrants(ctx context.Context, in *ReadGrantsRequest, opts ...client.CallOption) (*ReadGrantsResponse, error)
+	Authorize(ctx context.Context, in *AuthorizeRequest, opts ...client.CallOption) (*AuthorizeResponse, error)
+	PublicKeys(ctx context.Context, in *PublicKeysRequest, opts ...client.CallOption) (*PublicKeysResponse, error)
+	CreateApiKey(ctx context.Context, in *CreateApiKeyRequest, opts ...client.CallOption) (*CreateApiKeyResponse, error)
+	ListApiKeys(ctx context.Context, in *ListApiKeysRequest, opts ...client.CallOption) (*ListApiKeysResponse, error)
+	RevokeApiKey(ctx context.Context, in *RevokeApiKeyRequest, opts ...client.CallOption) (*RevokeApiKeyResponse, error)
+	ValidateApiKey(ctx context.Context, in *ValidateApiKeyRequest, opts ...client.CallOption) (*ValidateApiKeyResponse, error)
+	ListAuditEvents(ctx context.Context, in *ListAuditEventsRequest, opts ...client.CallOption) (*ListAuditEventsResponse, error)
+	Import(ctx context.Context, opts ...client.CallOption) (Users_ImportService, error)
+	Export(ctx context.Context, in *ExportRequest, opts ...client.CallOption) (Users_ExportService, error)
+	Impersonate(ctx context.Context, in *ImpersonateRequest, opts ...client.CallOption) (*ImpersonateResponse, error)
+	CreateInvite(ctx context.Context, in *CreateInviteRequest, opts ...client.CallOption) (*CreateInviteResponse, error)
+	ListInvites(ctx context.Context, in *ListInvitesRequest, opts ...client.CallOption) (*ListInvitesResponse, error)
+	RevokeInvite(ctx context.Context, in *RevokeInviteRequest, opts ...client.CallOption) (*RevokeInviteResponse, error)
+	CreateOrg(ctx context.Context, in *CreateOrgRequest, opts ...client.CallOption) (*CreateOrgResponse, error)
+	ReadOrg(ctx context.Context, in *ReadOrgRequest, opts ...client.CallOption) (*ReadOrgResponse, error)
+	UpdateOrg(ctx context.Context, in *UpdateOrgRequest, opts ...client.CallOption) (*UpdateOrgResponse, error)
+	DeleteOrg(ctx context.Context, in *DeleteOrgRequest, opts ...client.CallOption) (*DeleteOrgResponse, error)
+	InviteMember(ctx context.Context, in *InviteMemberRequest, opts ...client.CallOption) (*InviteMemberResponse, error)
+	AcceptMemberInvite(ctx context.Context, in *AcceptMemberInviteRequest, opts ...client.CallOption) (*AcceptMemberInviteResponse, error)
+	UpdateMember(ctx context.Context, in *UpdateMemberRequest, opts ...client.CallOption) (*UpdateMemberResponse, error)
+	RemoveMember(ctx context.Context, in *RemoveMemberRequest, opts ...client.CallOption) (*RemoveMemberResponse, error)
+	ListMembers(ctx context.Context, in *ListMembersRequest, opts ...client.CallOption) (*ListMembersResponse, error)
+	ListMemberships(ctx context.Context, in *ListMembershipsRequest, opts ...client.CallOption) (*ListMembershipsResponse, error)
+	SwitchOrg(ctx context.Context, in *SwitchOrgRequest, opts ...client.CallOption) (*SwitchOrgResponse, error)
 }
 
 type usersService struct {
@@ -95,6 +146,16 @@ func (c *usersService) Update(ctx context.Context, in *UpdateRequest, opts ...cl
 	return out, nil
 }
 
+func (c *usersService) ConfirmEmail(ctx context.Context, in *ConfirmEmailRequest, opts ...client.CallOption) (*ConfirmEmailResponse, error) {
+	req := c.c.NewRequest(c.name, "Users.ConfirmEmail", in)
+	out := new(ConfirmEmailResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func (c *usersService) Delete(ctx context.Context, in *DeleteRequest, opts ...client.CallOption) (*DeleteResponse, error) {
 	req := c.c.NewRequest(c.name, "Users.Delete", in)
 	out := new(DeleteResponse)
@@ -105,9 +166,499 @@ func (c *usersService) Delete(ctx context.Context, in *DeleteRequest, opts ...cl
 	return out, nil
 }
 
-func (c *usersService) Search(ctx context.Context, in *SearchRequest, opts ...client.CallOption) (*SearchResponse, error) {
-	req := c.c.NewRequest(c.name, "Users.Search", in)
-	out := new(SearchResponse)
+func (c *usersService) Restore(ctx context.Context, in *RestoreRequest, opts ...client.CallOption) (*RestoreResponse, error) {
+	req := c.c.NewRequest(c.name, "Users.Restore", in)
+	out := new(RestoreResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *usersService) Search(ctx context.Context, in *SearchRequest, opts ...client.CallOption) (*SearchResponse, error) {
+	req := c.c.NewRequest(c.name, "Users.Search", in)
+	out := new(SearchResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *usersService) List(ctx context.Context, in *ListRequest, opts ...client.CallOption) (*ListResponse, error) {
+	req := c.c.NewRequest(c.name, "Users.List", in)
+	out := new(ListResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *usersService) UpdatePassword(ctx context.Context, in *UpdatePasswordRequest, opts ...client.CallOption) (*UpdatePasswordResponse, error) {
+	req := c.c.NewRequest(c.name, "Users.UpdatePassword", in)
+	out := new(UpdatePasswordResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *usersService) Login(ctx context.Context, in *LoginRequest, opts ...client.CallOption) (*LoginResponse, error) {
+	req := c.c.NewRequest(c.name, "Users.Login", in)
+	out := new(LoginResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *usersService) Logout(ctx context.Context, in *LogoutRequest, opts ...client.CallOption) (*LogoutResponse, error) {
+	req := c.c.NewRequest(c.name, "Users.Logout", in)
+	out := new(LogoutResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *usersService) ReadSession(ctx context.Context, in *ReadSessionRequest, opts ...client.CallOption) (*ReadSessionResponse, error) {
+	req := c.c.NewRequest(c.name, "Users.ReadSession", in)
+	out := new(ReadSessionResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *usersService) Verify(ctx context.Context, in *VerifyRequest, opts ...client.CallOption) (*VerifyResponse, error) {
+	req := c.c.NewRequest(c.name, "Users.Verify", in)
+	out := new(VerifyResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *usersService) ResendVerification(ctx context.Context, in *ResendVerificationRequest, opts ...client.CallOption) (*ResendVerificationResponse, error) {
+	req := c.c.NewRequest(c.name, "Users.ResendVerification", in)
+	out := new(ResendVerificationResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *usersService) RequestPasswordReset(ctx context.Context, in *RequestPasswordResetRequest, opts ...client.CallOption) (*RequestPasswordResetResponse, error) {
+	req := c.c.NewRequest(c.name, "Users.RequestPasswordReset", in)
+	out := new(RequestPasswordResetResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *usersService) ResetPassword(ctx context.Context, in *ResetPasswordRequest, opts ...client.CallOption) (*ResetPasswordResponse, error) {
+	req := c.c.NewRequest(c.name, "Users.ResetPassword", in)
+	out := new(ResetPasswordResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *usersService) RefreshSession(ctx context.Context, in *RefreshSessionRequest, opts ...client.CallOption) (*RefreshSessionResponse, error) {
+	req := c.c.NewRequest(c.name, "Users.RefreshSession", in)
+	out := new(RefreshSessionResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *usersService) ListSessions(ctx context.Context, in *ListSessionsRequest, opts ...client.CallOption) (*ListSessionsResponse, error) {
+	req := c.c.NewRequest(c.name, "Users.ListSessions", in)
+	out := new(ListSessionsResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *usersService) RevokeAllSessions(ctx context.Context, in *RevokeAllSessionsRequest, opts ...client.CallOption) (*RevokeAllSessionsResponse, error) {
+	req := c.c.NewRequest(c.name, "Users.RevokeAllSessions", in)
+	out := new(RevokeAllSessionsResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *usersService) RevokeSession(ctx context.Context, in *RevokeSessionRequest, opts ...client.CallOption) (*RevokeSessionResponse, error) {
+	req := c.c.NewRequest(c.name, "Users.RevokeSession", in)
+	out := new(RevokeSessionResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *usersService) Enable2FA(ctx context.Context, in *Enable2FARequest, opts ...client.CallOption) (*Enable2FAResponse, error) {
+	req := c.c.NewRequest(c.name, "Users.Enable2FA", in)
+	out := new(Enable2FAResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *usersService) Confirm2FA(ctx context.Context, in *Confirm2FARequest, opts ...client.CallOption) (*Confirm2FAResponse, error) {
+	req := c.c.NewRequest(c.name, "Users.Confirm2FA", in)
+	out := new(Confirm2FAResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *usersService) Disable2FA(ctx context.Context, in *Disable2FARequest, opts ...client.CallOption) (*Disable2FAResponse, error) {
+	req := c.c.NewRequest(c.name, "Users.Disable2FA", in)
+	out := new(Disable2FAResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *usersService) OAuthURL(ctx context.Context, in *OAuthURLRequest, opts ...client.CallOption) (*OAuthURLResponse, error) {
+	req := c.c.NewRequest(c.name, "Users.OAuthURL", in)
+	out := new(OAuthURLResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *usersService) OAuthLogin(ctx context.Context, in *OAuthLoginRequest, opts ...client.CallOption) (*OAuthLoginResponse, error) {
+	req := c.c.NewRequest(c.name, "Users.OAuthLogin", in)
+	out := new(OAuthLoginResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *usersService) Unlock(ctx context.Context, in *UnlockRequest, opts ...client.CallOption) (*UnlockResponse, error) {
+	req := c.c.NewRequest(c.name, "Users.Unlock", in)
+	out := new(UnlockResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *usersService) SendLoginLink(ctx context.Context, in *SendLoginLinkRequest, opts ...client.CallOption) (*SendLoginLinkResponse, error) {
+	req := c.c.NewRequest(c.name, "Users.SendLoginLink", in)
+	out := new(SendLoginLinkResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *usersService) RedeemLoginLink(ctx context.Context, in *RedeemLoginLinkRequest, opts ...client.CallOption) (*RedeemLoginLinkResponse, error) {
+	req := c.c.NewRequest(c.name, "Users.RedeemLoginLink", in)
+	out := new(RedeemLoginLinkResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *usersService) SaveRole(ctx context.Context, in *SaveRoleRequest, opts ...client.CallOption) (*SaveRoleResponse, error) {
+	req := c.c.NewRequest(c.name, "Users.SaveRole", in)
+	out := new(SaveRoleResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *usersService) DeleteRole(ctx context.Context, in *DeleteRoleRequest, opts ...client.CallOption) (*DeleteRoleResponse, error) {
+	req := c.c.NewRequest(c.name, "Users.DeleteRole", in)
+	out := new(DeleteRoleResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *usersService) ListRoles(ctx context.Context, in *ListRolesRequest, opts ...client.CallOption) (*ListRolesResponse, error) {
+	req := c.c.NewRequest(c.name, "Users.ListRoles", in)
+	out := new(ListRolesResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *usersService) AssignRole(ctx context.Context, in *AssignRoleRequest, opts ...client.CallOption) (*AssignRoleResponse, error) {
+	req := c.c.NewRequest(c.name, "Users.AssignRole", in)
+	out := new(AssignRoleResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *usersService) RevokeRole(ctx context.Context, in *RevokeRoleRequest, opts ...client.CallOption) (*RevokeRoleResponse, error) {
+	req := c.c.NewRequest(c.name, "Users.RevokeRole", in)
+	out := new(RevokeRoleResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *usersService) GrantPermission(ctx context.Context, in *GrantPermissionRequest, opts ...client.CallOption) (*GrantPermissionResponse, error) {
+	req := c.c.NewRequest(c.name, "Users.GrantPermission", in)
+	out := new(GrantPermissionResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *usersService) RevokePermission(ctx context.Context, in *RevokePermissionRequest, opts ...client.CallOption) (*RevokePermissionResponse, error) {
+	req := c.c.NewRequest(c.name, "Users.RevokePermission", in)
+	out := new(RevokePermissionResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *usersService) ReadGrants(ctx context.Context, in *ReadGrantsRequest, opts ...client.CallOption) (*ReadGrantsResponse, error) {
+	req := c.c.NewRequest(c.name, "Users.ReadGrants", in)
+	out := new(ReadGrantsResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *usersService) Authorize(ctx context.Context, in *AuthorizeRequest, opts ...client.CallOption) (*AuthorizeResponse, error) {
+	req := c.c.NewRequest(c.name, "Users.Authorize", in)
+	out := new(AuthorizeResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *usersService) PublicKeys(ctx context.Context, in *PublicKeysRequest, opts ...client.CallOption) (*PublicKeysResponse, error) {
+	req := c.c.NewRequest(c.name, "Users.PublicKeys", in)
+	out := new(PublicKeysResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *usersService) CreateApiKey(ctx context.Context, in *CreateApiKeyRequest, opts ...client.CallOption) (*CreateApiKeyResponse, error) {
+	req := c.c.NewRequest(c.name, "Users.CreateApiKey", in)
+	out := new(CreateApiKeyResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *usersService) ListApiKeys(ctx context.Context, in *ListApiKeysRequest, opts ...client.CallOption) (*ListApiKeysResponse, error) {
+	req := c.c.NewRequest(c.name, "Users.ListApiKeys", in)
+	out := new(ListApiKeysResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *usersService) RevokeApiKey(ctx context.Context, in *RevokeApiKeyRequest, opts ...client.CallOption) (*RevokeApiKeyResponse, error) {
+	req := c.c.NewRequest(c.name, "Users.RevokeApiKey", in)
+	out := new(RevokeApiKeyResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *usersService) ValidateApiKey(ctx context.Context, in *ValidateApiKeyRequest, opts ...client.CallOption) (*ValidateApiKeyResponse, error) {
+	req := c.c.NewRequest(c.name, "Users.ValidateApiKey", in)
+	out := new(ValidateApiKeyResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *usersService) ListAuditEvents(ctx context.Context, in *ListAuditEventsRequest, opts ...client.CallOption) (*ListAuditEventsResponse, error) {
+	req := c.c.NewRequest(c.name, "Users.ListAuditEvents", in)
+	out := new(ListAuditEventsResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *usersService) Import(ctx context.Context, opts ...client.CallOption) (Users_ImportService, error) {
+	req := c.c.NewRequest(c.name, "Users.Import", &ImportRequest{})
+	stream, err := c.c.Stream(ctx, req, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &usersImport{stream}, nil
+}
+
+type Users_ImportService interface {
+	Context() context.Context
+	SendMsg(interface{}) error
+	RecvMsg(interface{}) error
+	Close() error
+	Send(*ImportRequest) error
+	Recv() (*ImportResponse, error)
+}
+
+type usersImport struct {
+	stream client.Stream
+}
+
+func (x *usersImport) Close() error {
+	return x.stream.Close()
+}
+
+func (x *usersImport) Context() context.Context {
+	return x.stream.Context()
+}
+
+func (x *usersImport) SendMsg(m interface{}) error {
+	return x.stream.Send(m)
+}
+
+func (x *usersImport) RecvMsg(m interface{}) error {
+	return x.stream.Recv(m)
+}
+
+func (x *usersImport) Send(m *ImportRequest) error {
+	return x.stream.Send(m)
+}
+
+func (x *usersImport) Recv() (*ImportResponse, error) {
+	m := new(ImportResponse)
+	err := x.stream.Recv(m)
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *usersService) Export(ctx context.Context, in *ExportRequest, opts ...client.CallOption) (Users_ExportService, error) {
+	req := c.c.NewRequest(c.name, "Users.Export", &ExportRequest{})
+	stream, err := c.c.Stream(ctx, req, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if err := stream.Send(in); err != nil {
+		return nil, err
+	}
+	return &usersServiceExport{stream}, nil
+}
+
+type Users_ExportService interface {
+	Context() context.Context
+	SendMsg(interface{}) error
+	RecvMsg(interface{}) error
+	Close() error
+	Recv() (*ExportResponse, error)
+}
+
+type usersServiceExport struct {
+	stream client.Stream
+}
+
+func (x *usersServiceExport) Close() error {
+	return x.stream.Close()
+}
+
+func (x *usersServiceExport) Context() context.Context {
+	return x.stream.Context()
+}
+
+func (x *usersServiceExport) SendMsg(m interface{}) error {
+	return x.stream.Send(m)
+}
+
+func (x *usersServiceExport) RecvMsg(m interface{}) error {
+	return x.stream.Recv(m)
+}
+
+func (x *usersServiceExport) Recv() (*ExportResponse, error) {
+	m := new(ExportResponse)
+	err := x.stream.Recv(m)
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *usersService) Impersonate(ctx context.Context, in *ImpersonateRequest, opts ...client.CallOption) (*ImpersonateResponse, error) {
+	req := c.c.NewRequest(c.name, "Users.Impersonate", in)
+	out := new(ImpersonateResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *usersService) CreateInvite(ctx context.Context, in *CreateInviteRequest, opts ...client.CallOption) (*CreateInviteResponse, error) {
+	req := c.c.NewRequest(c.name, "Users.CreateInvite", in)
+	out := new(CreateInviteResponse)
 	err := c.c.Call(ctx, req, out, opts...)
 	if err != nil {
 		return nil, err
@@ -115,9 +666,9 @@ func (c *usersService) Search(ctx context.Context, in *SearchRequest, opts ...cl
 	return out, nil
 }
 
-func (c *usersService) UpdatePassword(ctx context.Context, in *UpdatePasswordRequest, opts ...client.CallOption) (*UpdatePasswordResponse, error) {
-	req := c.c.NewRequest(c.name, "Users.UpdatePassword", in)
-	out := new(UpdatePasswordResponse)
+func (c *usersService) ListInvites(ctx context.Context, in *ListInvitesRequest, opts ...client.CallOption) (*ListInvitesResponse, error) {
+	req := c.c.NewRequest(c.name, "Users.ListInvites", in)
+	out := new(ListInvitesResponse)
 	err := c.c.Call(ctx, req, out, opts...)
 	if err != nil {
 		return nil, err
@@ -125,9 +676,9 @@ func (c *usersService) UpdatePassword(ctx context.Context, in *UpdatePasswordReq
 	return out, nil
 }
 
-func (c *usersService) Login(ctx context.Context, in *LoginRequest, opts ...client.CallOption) (*LoginResponse, error) {
-	req := c.c.NewRequest(c.name, "Users.Login", in)
-	out := new(LoginResponse)
+func (c *usersService) RevokeInvite(ctx context.Context, in *RevokeInviteRequest, opts ...client.CallOption) (*RevokeInviteResponse, error) {
+	req := c.c.NewRequest(c.name, "Users.RevokeInvite", in)
+	out := new(RevokeInviteResponse)
 	err := c.c.Call(ctx, req, out, opts...)
 	if err != nil {
 		return nil, err
@@ -135,9 +686,9 @@ func (c *usersService) Login(ctx context.Context, in *LoginRequest, opts ...clie
 	return out, nil
 }
 
-func (c *usersService) Logout(ctx context.Context, in *LogoutRequest, opts ...client.CallOption) (*LogoutResponse, error) {
-	req := c.c.NewRequest(c.name, "Users.Logout", in)
-	out := new(LogoutResponse)
+func (c *usersService) CreateOrg(ctx context.Context, in *CreateOrgRequest, opts ...client.CallOption) (*CreateOrgResponse, error) {
+	req := c.c.NewRequest(c.name, "Users.CreateOrg", in)
+	out := new(CreateOrgResponse)
 	err := c.c.Call(ctx, req, out, opts...)
 	if err != nil {
 		return nil, err
@@ -145,9 +696,99 @@ func (c *usersService) Logout(ctx context.Context, in *LogoutRequest, opts ...cl
 	return out, nil
 }
 
-func (c *usersService) ReadSession(ctx context.Context, in *ReadSessionRequest, opts ...client.CallOption) (*ReadSessionResponse, error) {
-	req := c.c.NewRequest(c.name, "Users.ReadSession", in)
-	out := new(ReadSessionResponse)
+func (c *usersService) ReadOrg(ctx context.Context, in *ReadOrgRequest, opts ...client.CallOption) (*ReadOrgResponse, error) {
+	req := c.c.NewRequest(c.name, "Users.ReadOrg", in)
+	out := new(ReadOrgResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *usersService) UpdateOrg(ctx context.Context, in *UpdateOrgRequest, opts ...client.CallOption) (*UpdateOrgResponse, error) {
+	req := c.c.NewRequest(c.name, "Users.UpdateOrg", in)
+	out := new(UpdateOrgResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *usersService) DeleteOrg(ctx context.Context, in *DeleteOrgRequest, opts ...client.CallOption) (*DeleteOrgResponse, error) {
+	req := c.c.NewRequest(c.name, "Users.DeleteOrg", in)
+	out := new(DeleteOrgResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *usersService) InviteMember(ctx context.Context, in *InviteMemberRequest, opts ...client.CallOption) (*InviteMemberResponse, error) {
+	req := c.c.NewRequest(c.name, "Users.InviteMember", in)
+	out := new(InviteMemberResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *usersService) AcceptMemberInvite(ctx context.Context, in *AcceptMemberInviteRequest, opts ...client.CallOption) (*AcceptMemberInviteResponse, error) {
+	req := c.c.NewRequest(c.name, "Users.AcceptMemberInvite", in)
+	out := new(AcceptMemberInviteResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *usersService) UpdateMember(ctx context.Context, in *UpdateMemberRequest, opts ...client.CallOption) (*UpdateMemberResponse, error) {
+	req := c.c.NewRequest(c.name, "Users.UpdateMember", in)
+	out := new(UpdateMemberResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *usersService) RemoveMember(ctx context.Context, in *RemoveMemberRequest, opts ...client.CallOption) (*RemoveMemberResponse, error) {
+	req := c.c.NewRequest(c.name, "Users.RemoveMember", in)
+	out := new(RemoveMemberResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *usersService) ListMembers(ctx context.Context, in *ListMembersRequest, opts ...client.CallOption) (*ListMembersResponse, error) {
+	req := c.c.NewRequest(c.name, "Users.ListMembers", in)
+	out := new(ListMembersResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *usersService) ListMemberships(ctx context.Context, in *ListMembershipsRequest, opts ...client.CallOption) (*ListMembershipsResponse, error) {
+	req := c.c.NewRequest(c.name, "Users.ListMemberships", in)
+	out := new(ListMembershipsResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *usersService) SwitchOrg(ctx context.Context, in *SwitchOrgRequest, opts ...client.CallOption) (*SwitchOrgResponse, error) {
+	req := c.c.NewRequest(c.name, "Users.SwitchOrg", in)
+	out := new(SwitchOrgResponse)
 	err := c.c.Call(ctx, req, out, opts...)
 	if err != nil {
 		return nil, err
@@ -161,12 +802,63 @@ type UsersHandler interface {
 	Create(context.Context, *CreateRequest, *CreateResponse) error
 	Read(context.Context, *ReadRequest, *ReadResponse) error
 	Update(context.Context, *UpdateRequest, *UpdateResponse) error
+	ConfirmEmail(context.Context, *ConfirmEmailRequest, *ConfirmEmailResponse) error
 	Delete(context.Context, *DeleteRequest, *DeleteResponse) error
+	Restore(context.Context, *RestoreRequest, *RestoreResponse) error
 	Search(context.Context, *SearchRequest, *SearchResponse) error
+	List(context.Context, *ListRequest, *ListResponse) error
 	UpdatePassword(context.Context, *UpdatePasswordRequest, *UpdatePasswordResponse) error
 	Login(context.Context, *LoginRequest, *LoginResponse) error
 	Logout(context.Context, *LogoutRequest, *LogoutResponse) error
 	ReadSession(context.Context, *ReadSessionRequest, *ReadSessionResponse) error
+	Verify(context.Context, *VerifyRequest, *VerifyResponse) error
+	ResendVerification(context.Context, *ResendVerificationRequest, *ResendVerificationResponse) error
+	RequestPasswordReset(context.Context, *RequestPasswordResetRequest, *RequestPasswordResetResponse) error
+	ResetPassword(context.Context, *ResetPasswordRequest, *ResetPasswordResponse) error
+	RefreshSession(context.Context, *RefreshSessionRequest, *RefreshSessionResponse) error
+	ListSessions(context.Context, *ListSessionsRequest, *ListSessionsResponse) error
+	RevokeAllSessions(context.Context, *RevokeAllSessionsRequest, *RevokeAllSessionsResponse) error
+	RevokeSession(context.Context, *RevokeSessionRequest, *RevokeSessionResponse) error
+	Enable2FA(context.Context, *Enable2FARequest, *Enable2FAResponse) error
+	Confirm2FA(context.Context, *Confirm2FARequest, *Confirm2FAResponse) error
+	Disable2FA(context.Context, *Disable2FARequest, *Disable2FAResponse) error
+	OAuthURL(context.Context, *OAuthURLRequest, *OAuthURLResponse) error
+	OAuthLogin(context.Context, *OAuthLoginRequest, *OAuthLoginResponse) error
+	Unlock(context.Context, *UnlockRequest, *UnlockResponse) error
+	SendLoginLink(context.Context, *SendLoginLinkRequest, *SendLoginLinkResponse) error
+	RedeemLoginLink(context.Context, *RedeemLoginLinkRequest, *RedeemLoginLinkResponse) error
+	SaveRole(context.Context, *SaveRoleRequest, *SaveRoleResponse) error
+	DeleteRole(context.Context, *DeleteRoleRequest, *DeleteRoleResponse) error
+	ListRoles(context.Context, *ListRolesRequest, *ListRolesResponse) error
+	AssignRole(context.Context, *AssignRoleRequest, *AssignRoleResponse) error
+	RevokeRole(context.Context, *RevokeRoleRequest, *RevokeRoleResponse) error
+	GrantPermission(context.Context, *GrantPermissionRequest, *GrantPermissionResponse) error
+	RevokePermission(context.Context, *RevokePermissionRequest, *RevokePermissionResponse) error
+	ReadGrants(context.Context, *ReadGrantsRequest, *ReadGrantsResponse) error
+	Authorize(context.Context, *AuthorizeRequest, *AuthorizeResponse) error
+	PublicKeys(context.Context, *PublicKeysRequest, *PublicKeysResponse) error
+	CreateApiKey(context.Context, *CreateApiKeyRequest, *CreateApiKeyResponse) error
+	ListApiKeys(context.Context, *ListApiKeysRequest, *ListApiKeysResponse) error
+	RevokeApiKey(context.Context, *RevokeApiKeyRequest, *RevokeApiKeyResponse) error
+	ValidateApiKey(context.Context, *ValidateApiKeyRequest, *ValidateApiKeyResponse) error
+	ListAuditEvents(context.Context, *ListAuditEventsRequest, *ListAuditEventsResponse) error
+	Import(context.Context, Users_ImportStream) error
+	Export(context.Context, *ExportRequest, Users_ExportStream) error
+	Impersonate(context.Context, *ImpersonateRequest, *ImpersonateResponse) error
+	CreateInvite(context.Context, *CreateInviteRequest, *CreateInviteResponse) error
+	ListInvites(context.Context, *ListInvitesRequest, *ListInvitesResponse) error
+	RevokeInvite(context.Context, *RevokeInviteRequest, *RevokeInviteResponse) error
+	CreateOrg(context.Context, *CreateOrgRequest, *CreateOrgResponse) error
+	ReadOrg(context.Context, *ReadOrgRequest, *ReadOrgResponse) error
+	UpdateOrg(context.Context, *UpdateOrgRequest, *UpdateOrgResponse) error
+	DeleteOrg(context.Context, *DeleteOrgRequest, *DeleteOrgResponse) error
+	InviteMember(context.Context, *InviteMemberRequest, *InviteMemberResponse) error
+	AcceptMemberInvite(context.Context, *AcceptMemberInviteRequest, *AcceptMemberInviteResponse) error
+	UpdateMember(context.Context, *UpdateMemberRequest, *UpdateMemberResponse) error
+	RemoveMember(context.Context, *RemoveMemberRequest, *RemoveMemberResponse) error
+	ListMembers(context.Context, *ListMembersRequest, *ListMembersResponse) error
+	ListMemberships(context.Context, *ListMembershipsRequest, *ListMembershipsResponse) error
+	SwitchOrg(context.Context, *SwitchOrgRequest, *SwitchOrgResponse) error
 }
 
 func RegisterUsersHandler(s server.Server, hdlr UsersHandler, opts ...server.HandlerOption) error {
@@ -174,12 +866,63 @@ func RegisterUsersHandler(s server.Server, hdlr UsersHandler, opts ...server.Han
 		Create(ctx context.Context, in *CreateRequest, out *CreateResponse) error
 		Read(ctx context.Context, in *ReadRequest, out *ReadResponse) error
 		Update(ctx context.Context, in *UpdateRequest, out *UpdateResponse) error
+		ConfirmEmail(ctx context.Context, in *ConfirmEmailRequest, out *ConfirmEmailResponse) error
 		Delete(ctx context.Context, in *DeleteRequest, out *DeleteResponse) error
+		Restore(ctx context.Context, in *RestoreRequest, out *RestoreResponse) error
 		Search(ctx context.Context, in *SearchRequest, out *SearchResponse) error
+		List(ctx context.Context, in *ListRequest, out *ListResponse) error
 		UpdatePassword(ctx context.Context, in *UpdatePasswordRequest, out *UpdatePasswordResponse) error
 		Login(ctx context.Context, in *LoginRequest, out *LoginResponse) error
 		Logout(ctx context.Context, in *LogoutRequest, out *LogoutResponse) error
 		ReadSession(ctx context.Context, in *ReadSessionRequest, out *ReadSessionResponse) error
+		Verify(ctx context.Context, in *VerifyRequest, out *VerifyResponse) error
+		ResendVerification(ctx context.Context, in *ResendVerificationRequest, out *ResendVerificationResponse) error
+		RequestPasswordReset(ctx context.Context, in *RequestPasswordResetRequest, out *RequestPasswordResetResponse) error
+		ResetPassword(ctx context.Context, in *ResetPasswordRequest, out *ResetPasswordResponse) error
+		RefreshSession(ctx context.Context, in *RefreshSessionRequest, out *RefreshSessionResponse) error
+		ListSessions(ctx context.Context, in *ListSessionsRequest, out *ListSessionsResponse) error
+		RevokeAllSessions(ctx context.Context, in *RevokeAllSessionsRequest, out *RevokeAllSessionsResponse) error
+		RevokeSession(ctx context.Context, in *RevokeSessionRequest, out *RevokeSessionResponse) error
+		Enable2FA(ctx context.Context, in *Enable2FARequest, out *Enable2FAResponse) error
+		Confirm2FA(ctx context.Context, in *Confirm2FARequest, out *Confirm2FAResponse) error
+		Disable2FA(ctx context.Context, in *Disable2FARequest, out *Disable2FAResponse) error
+		OAuthURL(ctx context.Context, in *OAuthURLRequest, out *OAuthURLResponse) error
+		OAuthLogin(ctx context.Context, in *OAuthLoginRequest, out *OAuthLoginResponse) error
+		Unlock(ctx context.Context, in *UnlockRequest, out *UnlockResponse) error
+		SendLoginLink(ctx context.Context, in *SendLoginLinkRequest, out *SendLoginLinkResponse) error
+		RedeemLoginLink(ctx context.Context, in *RedeemLoginLinkRequest, out *RedeemLoginLinkResponse) error
+		SaveRole(ctx context.Context, in *SaveRoleRequest, out *SaveRoleResponse) error
+		DeleteRole(ctx context.Context, in *DeleteRoleRequest, out *DeleteRoleResponse) error
+		ListRoles(ctx context.Context, in *ListRolesRequest, out *ListRolesResponse) error
+		AssignRole(ctx context.Context, in *AssignRoleRequest, out *AssignRoleResponse) error
+		RevokeRole(ctx context.Context, in *RevokeRoleRequest, out *RevokeRoleResponse) error
+		GrantPermission(ctx context.Context, in *GrantPermissionRequest, out *GrantPermissionResponse) error
+		RevokePermission(ctx context.Context, in *RevokePermissionRequest, out *RevokePermissionResponse) error
+		ReadGrants(ctx context.Context, in *ReadGrantsRequest, out *ReadGrantsResponse) error
+		Authorize(ctx context.Context, in *AuthorizeRequest, out *AuthorizeResponse) error
+		PublicKeys(ctx context.Context, in *PublicKeysRequest, out *PublicKeysResponse) error
+		CreateApiKey(ctx context.Context, in *CreateApiKeyRequest, out *CreateApiKeyResponse) error
+		ListApiKeys(ctx context.Context, in *ListApiKeysRequest, out *ListApiKeysResponse) error
+		RevokeApiKey(ctx context.Context, in *RevokeApiKeyRequest, out *RevokeApiKeyResponse) error
+		ValidateApiKey(ctx context.Context, in *ValidateApiKeyRequest, out *ValidateApiKeyResponse) error
+		ListAuditEvents(ctx context.Context, in *ListAuditEventsRequest, out *ListAuditEventsResponse) error
+		Import(ctx context.Context, stream server.Stream) error
+		Export(ctx context.Context, stream server.Stream) error
+		Impersonate(ctx context.Context, in *ImpersonateRequest, out *ImpersonateResponse) error
+		CreateInvite(ctx context.Context, in *CreateInviteRequest, out *CreateInviteResponse) error
+		ListInvites(ctx context.Context, in *ListInvitesRequest, out *ListInvitesResponse) error
+		RevokeInvite(ctx context.Context, in *RevokeInviteRequest, out *RevokeInviteResponse) error
+		CreateOrg(ctx context.Context, in *CreateOrgRequest, out *CreateOrgResponse) error
+		ReadOrg(ctx context.Context, in *ReadOrgRequest, out *ReadOrgResponse) error
+		UpdateOrg(ctx context.Context, in *UpdateOrgRequest, out *UpdateOrgResponse) error
+		DeleteOrg(ctx context.Context, in *DeleteOrgRequest, out *DeleteOrgResponse) error
+		InviteMember(ctx context.Context, in *InviteMemberRequest, out *InviteMemberResponse) error
+		AcceptMemberInvite(ctx context.Context, in *AcceptMemberInviteRequest, out *AcceptMemberInviteResponse) error
+		UpdateMember(ctx context.Context, in *UpdateMemberRequest, out *UpdateMemberResponse) error
+		RemoveMember(ctx context.Context, in *RemoveMemberRequest, out *RemoveMemberResponse) error
+		ListMembers(ctx context.Context, in *ListMembersRequest, out *ListMembersResponse) error
+		ListMemberships(ctx context.Context, in *ListMembershipsRequest, out *ListMembershipsResponse) error
+		SwitchOrg(ctx context.Context, in *SwitchOrgRequest, out *SwitchOrgResponse) error
 	}
 	type Users struct {
 		users
@@ -204,14 +947,26 @@ func (h *usersHandler) Update(ctx context.Context, in *UpdateRequest, out *Updat
 	return h.UsersHandler.Update(ctx, in, out)
 }
 
+func (h *usersHandler) ConfirmEmail(ctx context.Context, in *ConfirmEmailRequest, out *ConfirmEmailResponse) error {
+	return h.UsersHandler.ConfirmEmail(ctx, in, out)
+}
+
 func (h *usersHandler) Delete(ctx context.Context, in *DeleteRequest, out *DeleteResponse) error {
 	return h.UsersHandler.Delete(ctx, in, out)
 }
 
+func (h *usersHandler) Restore(ctx context.Context, in *RestoreRequest, out *RestoreResponse) error {
+	return h.UsersHandler.Restore(ctx, in, out)
+}
+
 func (h *usersHandler) Search(ctx context.Context, in *SearchRequest, out *SearchResponse) error {
 	return h.UsersHandler.Search(ctx, in, out)
 }
 
+func (h *usersHandler) List(ctx context.Context, in *ListRequest, out *ListResponse) error {
+	return h.UsersHandler.List(ctx, in, out)
+}
+
 func (h *usersHandler) UpdatePassword(ctx context.Context, in *UpdatePasswordRequest, out *UpdatePasswordResponse) error {
 	return h.UsersHandler.UpdatePassword(ctx, in, out)
 }
@@ -227,3 +982,272 @@ func (h *usersHandler) Logout(ctx context.Context, in *LogoutRequest, out *Logou
 func (h *usersHandler) ReadSession(ctx context.Context, in *ReadSessionRequest, out *ReadSessionResponse) error {
 	return h.UsersHandler.ReadSession(ctx, in, out)
 }
+
+func (h *usersHandler) Verify(ctx context.Context, in *VerifyRequest, out *VerifyResponse) error {
+	return h.UsersHandler.Verify(ctx, in, out)
+}
+
+func (h *usersHandler) ResendVerification(ctx context.Context, in *ResendVerificationRequest, out *ResendVerificationResponse) error {
+	return h.UsersHandler.ResendVerification(ctx, in, out)
+}
+
+func (h *usersHandler) RequestPasswordReset(ctx context.Context, in *RequestPasswordResetRequest, out *RequestPasswordResetResponse) error {
+	return h.UsersHandler.RequestPasswordReset(ctx, in, out)
+}
+
+func (h *usersHandler) ResetPassword(ctx context.Context, in *ResetPasswordRequest, out *ResetPasswordResponse) error {
+	return h.UsersHandler.ResetPassword(ctx, in, out)
+}
+
+func (h *usersHandler) RefreshSession(ctx context.Context, in *RefreshSessionRequest, out *RefreshSessionResponse) error {
+	return h.UsersHandler.RefreshSession(ctx, in, out)
+}
+
+func (h *usersHandler) ListSessions(ctx context.Context, in *ListSessionsRequest, out *ListSessionsResponse) error {
+	return h.UsersHandler.ListSessions(ctx, in, out)
+}
+
+func (h *usersHandler) RevokeAllSessions(ctx context.Context, in *RevokeAllSessionsRequest, out *RevokeAllSessionsResponse) error {
+	return h.UsersHandler.RevokeAllSessions(ctx, in, out)
+}
+
+func (h *usersHandler) RevokeSession(ctx context.Context, in *RevokeSessionRequest, out *RevokeSessionResponse) error {
+	return h.UsersHandler.RevokeSession(ctx, in, out)
+}
+
+func (h *usersHandler) Enable2FA(ctx context.Context, in *Enable2FARequest, out *Enable2FAResponse) error {
+	return h.UsersHandler.Enable2FA(ctx, in, out)
+}
+
+func (h *usersHandler) Confirm2FA(ctx context.Context, in *Confirm2FARequest, out *Confirm2FAResponse) error {
+	return h.UsersHandler.Confirm2FA(ctx, in, out)
+}
+
+func (h *usersHandler) Disable2FA(ctx context.Context, in *Disable2FARequest, out *Disable2FAResponse) error {
+	return h.UsersHandler.Disable2FA(ctx, in, out)
+}
+
+func (h *usersHandler) OAuthURL(ctx context.Context, in *OAuthURLRequest, out *OAuthURLResponse) error {
+	return h.UsersHandler.OAuthURL(ctx, in, out)
+}
+
+func (h *usersHandler) OAuthLogin(ctx context.Context, in *OAuthLoginRequest, out *OAuthLoginResponse) error {
+	return h.UsersHandler.OAuthLogin(ctx, in, out)
+}
+
+func (h *usersHandler) Unlock(ctx context.Context, in *UnlockRequest, out *UnlockResponse) error {
+	return h.UsersHandler.Unlock(ctx, in, out)
+}
+
+func (h *usersHandler) SendLoginLink(ctx context.Context, in *SendLoginLinkRequest, out *SendLoginLinkResponse) error {
+	return h.UsersHandler.SendLoginLink(ctx, in, out)
+}
+
+func (h *usersHandler) RedeemLoginLink(ctx context.Context, in *RedeemLoginLinkRequest, out *RedeemLoginLinkResponse) error {
+	return h.UsersHandler.RedeemLoginLink(ctx, in, out)
+}
+
+func (h *usersHandler) SaveRole(ctx context.Context, in *SaveRoleRequest, out *SaveRoleResponse) error {
+	return h.UsersHandler.SaveRole(ctx, in, out)
+}
+
+func (h *usersHandler) DeleteRole(ctx context.Context, in *DeleteRoleRequest, out *DeleteRoleResponse) error {
+	return h.UsersHandler.DeleteRole(ctx, in, out)
+}
+
+func (h *usersHandler) ListRoles(ctx context.Context, in *ListRolesRequest, out *ListRolesResponse) error {
+	return h.UsersHandler.ListRoles(ctx, in, out)
+}
+
+func (h *usersHandler) AssignRole(ctx context.Context, in *AssignRoleRequest, out *AssignRoleResponse) error {
+	return h.UsersHandler.AssignRole(ctx, in, out)
+}
+
+func (h *usersHandler) RevokeRole(ctx context.Context, in *RevokeRoleRequest, out *RevokeRoleResponse) error {
+	return h.UsersHandler.RevokeRole(ctx, in, out)
+}
+
+func (h *usersHandler) GrantPermission(ctx context.Context, in *GrantPermissionRequest, out *GrantPermissionResponse) error {
+	return h.UsersHandler.GrantPermission(ctx, in, out)
+}
+
+func (h *usersHandler) RevokePermission(ctx context.Context, in *RevokePermissionRequest, out *RevokePermissionResponse) error {
+	return h.UsersHandler.RevokePermission(ctx, in, out)
+}
+
+func (h *usersHandler) ReadGrants(ctx context.Context, in *ReadGrantsRequest, out *ReadGrantsResponse) error {
+	return h.UsersHandler.ReadGrants(ctx, in, out)
+}
+
+func (h *usersHandler) Authorize(ctx context.Context, in *AuthorizeRequest, out *AuthorizeResponse) error {
+	return h.UsersHandler.Authorize(ctx, in, out)
+}
+
+func (h *usersHandler) PublicKeys(ctx context.Context, in *PublicKeysRequest, out *PublicKeysResponse) error {
+	return h.UsersHandler.PublicKeys(ctx, in, out)
+}
+
+func (h *usersHandler) CreateApiKey(ctx context.Context, in *CreateApiKeyRequest, out *CreateApiKeyResponse) error {
+	return h.UsersHandler.CreateApiKey(ctx, in, out)
+}
+
+func (h *usersHandler) ListApiKeys(ctx context.Context, in *ListApiKeysRequest, out *ListApiKeysResponse) error {
+	return h.UsersHandler.ListApiKeys(ctx, in, out)
+}
+
+func (h *usersHandler) RevokeApiKey(ctx context.Context, in *RevokeApiKeyRequest, out *RevokeApiKeyResponse) error {
+	return h.UsersHandler.RevokeApiKey(ctx, in, out)
+}
+
+func (h *usersHandler) ValidateApiKey(ctx context.Context, in *ValidateApiKeyRequest, out *ValidateApiKeyResponse) error {
+	return h.UsersHandler.ValidateApiKey(ctx, in, out)
+}
+
+func (h *usersHandler) ListAuditEvents(ctx context.Context, in *ListAuditEventsRequest, out *ListAuditEventsResponse) error {
+	return h.UsersHandler.ListAuditEvents(ctx, in, out)
+}
+
+func (h *usersHandler) Import(ctx context.Context, stream server.Stream) error {
+	return h.UsersHandler.Import(ctx, &usersImportStream{stream})
+}
+
+type Users_ImportStream interface {
+	Context() context.Context
+	SendMsg(interface{}) error
+	RecvMsg(interface{}) error
+	Close() error
+	Send(*ImportResponse) error
+	Recv() (*ImportRequest, error)
+}
+
+type usersImportStream struct {
+	stream server.Stream
+}
+
+func (x *usersImportStream) Close() error {
+	return x.stream.Close()
+}
+
+func (x *usersImportStream) Context() context.Context {
+	return x.stream.Context()
+}
+
+func (x *usersImportStream) SendMsg(m interface{}) error {
+	return x.stream.Send(m)
+}
+
+func (x *usersImportStream) RecvMsg(m interface{}) error {
+	return x.stream.Recv(m)
+}
+
+func (x *usersImportStream) Send(m *ImportResponse) error {
+	return x.stream.Send(m)
+}
+
+func (x *usersImportStream) Recv() (*ImportRequest, error) {
+	m := new(ImportRequest)
+	if err := x.stream.Recv(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (h *usersHandler) Export(ctx context.Context, stream server.Stream) error {
+	m := new(ExportRequest)
+	if err := stream.Recv(m); err != nil {
+		return err
+	}
+	return h.UsersHandler.Export(ctx, m, &usersExportStream{stream})
+}
+
+type Users_ExportStream interface {
+	Context() context.Context
+	SendMsg(interface{}) error
+	RecvMsg(interface{}) error
+	Close() error
+	Send(*ExportResponse) error
+}
+
+type usersExportStream struct {
+	stream server.Stream
+}
+
+func (x *usersExportStream) Close() error {
+	return x.stream.Close()
+}
+
+func (x *usersExportStream) Context() context.Context {
+	return x.stream.Context()
+}
+
+func (x *usersExportStream) SendMsg(m interface{}) error {
+	return x.stream.Send(m)
+}
+
+func (x *usersExportStream) RecvMsg(m interface{}) error {
+	return x.stream.Recv(m)
+}
+
+func (x *usersExportStream) Send(m *ExportResponse) error {
+	return x.stream.Send(m)
+}
+
+func (h *usersHandler) Impersonate(ctx context.Context, in *ImpersonateRequest, out *ImpersonateResponse) error {
+	return h.UsersHandler.Impersonate(ctx, in, out)
+}
+
+func (h *usersHandler) CreateInvite(ctx context.Context, in *CreateInviteRequest, out *CreateInviteResponse) error {
+	return h.UsersHandler.CreateInvite(ctx, in, out)
+}
+
+func (h *usersHandler) ListInvites(ctx context.Context, in *ListInvitesRequest, out *ListInvitesResponse) error {
+	return h.UsersHandler.ListInvites(ctx, in, out)
+}
+
+func (h *usersHandler) RevokeInvite(ctx context.Context, in *RevokeInviteRequest, out *RevokeInviteResponse) error {
+	return h.UsersHandler.RevokeInvite(ctx, in, out)
+}
+
+func (h *usersHandler) CreateOrg(ctx context.Context, in *CreateOrgRequest, out *CreateOrgResponse) error {
+	return h.UsersHandler.CreateOrg(ctx, in, out)
+}
+
+func (h *usersHandler) ReadOrg(ctx context.Context, in *ReadOrgRequest, out *ReadOrgResponse) error {
+	return h.UsersHandler.ReadOrg(ctx, in, out)
+}
+
+func (h *usersHandler) UpdateOrg(ctx context.Context, in *UpdateOrgRequest, out *UpdateOrgResponse) error {
+	return h.UsersHandler.UpdateOrg(ctx, in, out)
+}
+
+func (h *usersHandler) DeleteOrg(ctx context.Context, in *DeleteOrgRequest, out *DeleteOrgResponse) error {
+	return h.UsersHandler.DeleteOrg(ctx, in, out)
+}
+
+func (h *usersHandler) InviteMember(ctx context.Context, in *InviteMemberRequest, out *InviteMemberResponse) error {
+	return h.UsersHandler.InviteMember(ctx, in, out)
+}
+
+func (h *usersHandler) AcceptMemberInvite(ctx context.Context, in *AcceptMemberInviteRequest, out *AcceptMemberInviteResponse) error {
+	return h.UsersHandler.AcceptMemberInvite(ctx, in, out)
+}
+
+func (h *usersHandler) UpdateMember(ctx context.Context, in *UpdateMemberRequest, out *UpdateMemberResponse) error {
+	return h.UsersHandler.UpdateMember(ctx, in, out)
+}
+
+func (h *usersHandler) RemoveMember(ctx context.Context, in *RemoveMemberRequest, out *RemoveMemberResponse) error {
+	return h.UsersHandler.RemoveMember(ctx, in, out)
+}
+
+func (h *usersHandler) ListMembers(ctx context.Context, in *ListMembersRequest, out *ListMembersResponse) error {
+	return h.UsersHandler.ListMembers(ctx, in, out)
+}
+
+func (h *usersHandler) ListMemberships(ctx context.Context, in *ListMembershipsRequest, out *ListMembershipsResponse) error {
+	return h.UsersHandler.ListMemberships(ctx, in, out)
+}
+
+func (h *usersHandler) SwitchOrg(ctx context.Context, in *SwitchOrgRequest, out *SwitchOrgResponse) error {
+	return h.UsersHandler.SwitchOrg(ctx, in, out)
+}
@@ -0,0 +1,108 @@
+// Package subscriber lets other services react to users being created,
+// verified, updated, deleted or logging in. Every handler is called with the
+// typed event, returning an error redelivers it.
+//
+//	err := subscriber.Deleted("posts", func(ev *users.UserDeleted) error {
+//		return deletePostsOf(ev.Tenant, ev.Id)
+//	})
+package subscriber
+
+import (
+	"time"
+
+	pb "github.com/embedscript/backend/users/proto"
+	"github.com/micro/micro/v3/service/events"
+	"github.com/micro/micro/v3/service/logger"
+)
+
+// Topics the users service publishes events on
+const (
+	TopicCreated  = "user.created"
+	TopicVerified = "user.verified"
+	TopicUpdated  = "user.updated"
+	// TopicDeleted is published when a user is deleted. Soft deleted users
+	// are published again with Soft unset once they're purged.
+	TopicDeleted  = "user.deleted"
+	TopicLoggedIn = "user.login"
+)
+
+// ackWait is how long a handler has before an event it hasn't acked is
+// delivered again
+const ackWait = 30 * time.Second
+
+// Created calls the handler with every user created. The group is usually
+// the name of the service, each event is delivered to one member of a group.
+func Created(group string, h func(*pb.UserCreated) error) error {
+	return consume(TopicCreated, group, func(ev *events.Event) error {
+		msg := &pb.UserCreated{}
+		if err := ev.Unmarshal(msg); err != nil {
+			return err
+		}
+		return h(msg)
+	})
+}
+
+// Verified calls the handler with every user who verified their email
+func Verified(group string, h func(*pb.UserVerified) error) error {
+	return consume(TopicVerified, group, func(ev *events.Event) error {
+		msg := &pb.UserVerified{}
+		if err := ev.Unmarshal(msg); err != nil {
+			return err
+		}
+		return h(msg)
+	})
+}
+
+// Updated calls the handler with every user updated
+func Updated(group string, h func(*pb.UserUpdated) error) error {
+	return consume(TopicUpdated, group, func(ev *events.Event) error {
+		msg := &pb.UserUpdated{}
+		if err := ev.Unmarshal(msg); err != nil {
+			return err
+		}
+		return h(msg)
+	})
+}
+
+// Deleted calls the handler with every user deleted
+func Deleted(group string, h func(*pb.UserDeleted) error) error {
+	return consume(TopicDeleted, group, func(ev *events.Event) error {
+		msg := &pb.UserDeleted{}
+		if err := ev.Unmarshal(msg); err != nil {
+			return err
+		}
+		return h(msg)
+	})
+}
+
+// LoggedIn calls the handler with every successful login
+func LoggedIn(group string, h func(*pb.UserLoggedIn) error) error {
+	return consume(TopicLoggedIn, group, func(ev *events.Event) error {
+		msg := &pb.UserLoggedIn{}
+		if err := ev.Unmarshal(msg); err != nil {
+			return err
+		}
+		return h(msg)
+	})
+}
+
+// consume handles the events of a topic in the background. Events are only
+// acked once handled, so ones that failed or were in flight when the
+// consumer stopped are delivered again.
+func consume(topic, group string, h func(*events.Event) error) error {
+	ch, err := events.Consume(topic, events.WithGroup(group), events.WithAutoAck(false, ackWait))
+	if err != nil {
+		return err
+	}
+	go func() {
+		for ev := range ch {
+			if err := h(&ev); err != nil {
+				logger.Errorf("Error handling %v event %v: %v", topic, ev.ID, err)
+				ev.Nack()
+				continue
+			}
+			ev.Ack()
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,73 @@
+package totp
+
+import (
+	"testing"
+	"time"
+)
+
+// secret is the RFC 4226 test key "12345678901234567890" in base32
+const secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestCode(t *testing.T) {
+	// test values from RFC 4226 appendix D
+	codes := []string{
+		"755224", "287082", "359152", "969429", "338314",
+		"254676", "287922", "162583", "399871", "520489",
+	}
+	for counter, want := range codes {
+		got, err := Code(secret, int64(counter))
+		if err != nil {
+			t.Fatalf("Code(%v): %v", counter, err)
+		}
+		if got != want {
+			t.Errorf("Code(%v) = %v, want %v", counter, got, want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(Period*100+10, 0)
+	code := func(counter int64) string {
+		c, err := Code(secret, counter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+
+	tests := []struct {
+		name    string
+		code    string
+		skew    int
+		counter int64
+		ok      bool
+	}{
+		{name: "current", code: code(100), skew: 1, counter: 100, ok: true},
+		{name: "previous", code: code(99), skew: 1, counter: 99, ok: true},
+		{name: "next", code: code(101), skew: 1, counter: 101, ok: true},
+		{name: "spaces", code: " " + code(100) + " ", skew: 1, counter: 100, ok: true},
+		{name: "outside skew", code: code(98), skew: 1},
+		{name: "no skew", code: code(99), skew: 0},
+		{name: "wrong code", code: "000000", skew: 1},
+		{name: "too short", code: code(100)[:5], skew: 1},
+		{name: "too long", code: code(100) + "0", skew: 1},
+		{name: "empty", code: "", skew: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			counter, ok := Validate(tt.code, secret, now, tt.skew)
+			if ok != tt.ok {
+				t.Fatalf("Validate() ok = %v, want %v", ok, tt.ok)
+			}
+			if ok && counter != tt.counter {
+				t.Errorf("Validate() counter = %v, want %v", counter, tt.counter)
+			}
+		})
+	}
+}
+
+func TestValidateInvalidSecret(t *testing.T) {
+	if _, ok := Validate("123456", "not base32!", time.Unix(0, 0), 1); ok {
+		t.Error("Validate() accepted a code for an invalid secret")
+	}
+}